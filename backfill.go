@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// backfillOptions 回补历史开奖数据的参数
+type backfillOptions struct {
+	IssueStart string
+	IssueEnd   string
+	DayStart   string
+	DayEnd     string
+}
+
+// runBackfill 解析 backfill 子命令的参数并执行回补
+//
+//	LotteryServer [-source cwl] backfill [-game ssq] [-issue-start 2021001] [-issue-end 2021150] [-day-start 2021-11-28 -day-end 2022-02-08]
+func runBackfill(store *LotteryStore, sources map[string]DrawSource, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	var opts backfillOptions
+	gameCode := fs.String("game", defaultGameCode, "玩法：ssq、dlt、3d、qlc、kl8")
+	fs.StringVar(&opts.IssueStart, "issue-start", "", "起始期号，为空时从库中最新一期继续")
+	fs.StringVar(&opts.IssueEnd, "issue-end", "", "结束期号，为空表示到最新一期")
+	fs.StringVar(&opts.DayStart, "day-start", "", "起始开奖日期，如 2021-11-28，指定日期时不按期号续传")
+	fs.StringVar(&opts.DayEnd, "day-end", "", "结束开奖日期，如 2022-02-08")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	game, err := gameByCode(*gameCode)
+	if err != nil {
+		return err
+	}
+
+	saved, err := backfillDraws(store, game, sources[game.Code()], opts)
+	if err != nil {
+		return err
+	}
+	fmt.Println(game.Name(), "回补完成，共保存开奖结果期数:", saved)
+	return nil
+}
+
+// backfillDraws 按期号或日期范围拉取开奖结果并入库，返回保存的期数
+// 按期号回补时逐年请求、逐年提交，中途失败后库里最新的一期之前都是完整的，
+// 下次不指定 -issue-start 即可从最新一期续传
+func backfillDraws(store *LotteryStore, game Game, source DrawSource, opts backfillOptions) (int, error) {
+	if opts.DayStart != "" || opts.DayEnd != "" {
+		items, err := source.DayRange(opts.DayStart, opts.DayEnd)
+		if err != nil {
+			return 0, err
+		}
+		return saveKjggItems(store, game, items)
+	}
+
+	issueStart := opts.IssueStart
+	if issueStart == "" {
+		latest, err := store.LatestDrawCode(game.Code())
+		if err != nil {
+			return 0, err
+		}
+		issueStart = latest
+	}
+	if issueStart == "" {
+		issueStart = game.FirstIssue()
+	}
+
+	startYear, err := issueYear(issueStart)
+	if err != nil {
+		return 0, err
+	}
+	endYear := time.Now().Year()
+	if opts.IssueEnd != "" {
+		if endYear, err = issueYear(opts.IssueEnd); err != nil {
+			return 0, err
+		}
+	}
+
+	saved := 0
+	for year := startYear; year <= endYear; year++ {
+		from := fmt.Sprintf("%d001", year)
+		if year == startYear {
+			from = issueStart
+		}
+		to := fmt.Sprintf("%d999", year)
+		if year == endYear && opts.IssueEnd != "" {
+			to = opts.IssueEnd
+		}
+
+		items, err := source.Range(from, to)
+		if err != nil {
+			return saved, fmt.Errorf("获取%s至%s期失败: %w", from, to, err)
+		}
+		n, err := saveKjggItems(store, game, items)
+		saved += n
+		if err != nil {
+			return saved, err
+		}
+		fmt.Printf("%d年已保存%d期\n", year, n)
+	}
+	return saved, nil
+}
+
+// saveKjggItems 将开奖公告转换后入库，格式错误的期跳过
+func saveKjggItems(store *LotteryStore, game Game, items []KjggItem) (int, error) {
+	var draws []Draw
+	for _, item := range items {
+		draw, err := drawFromKjggItem(game, item)
+		if err != nil {
+			fmt.Println("解析开奖公告失败:", err)
+			continue
+		}
+		draws = append(draws, draw)
+	}
+	if err := store.UpsertDraws(draws); err != nil {
+		return 0, err
+	}
+	return len(draws), nil
+}
+
+// issueYear 期号的前四位是年份
+func issueYear(code string) (int, error) {
+	if len(code) < 5 {
+		return 0, fmt.Errorf("期号格式错误: %s", code)
+	}
+	year, err := strconv.Atoi(code[:4])
+	if err != nil {
+		return 0, fmt.Errorf("期号格式错误: %s", code)
+	}
+	return year, nil
+}
+
+// LatestDrawCode 返回库中某个玩法最新一期的期号，没有开奖结果时返回空串
+func (s *LotteryStore) LatestDrawCode(game string) (string, error) {
+	var code sql.NullString
+	if err := s.db.QueryRow("select max(code) from draws where game=?;", game).Scan(&code); err != nil {
+		return "", fmt.Errorf("查询最新期号失败: %w", err)
+	}
+	return code.String, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// ssqFixtureItems 生成 2021 年第 140-153 期和 2022 年第 1-10 期双色球开奖公告，每期号码不同
+func ssqFixtureItems() []KjggItem {
+	var items []KjggItem
+	add := func(code string, day time.Time, k int) {
+		items = append(items, KjggItem{
+			Name: "双色球",
+			Code: code,
+			Date: day.Format("2006-01-02"),
+			Red:  fmt.Sprintf("%02d,%02d,%02d,%02d,%02d,%02d", k%5+1, k%5+7, k%5+13, k%5+19, k%5+25, k%3+31),
+			Blue: fmt.Sprintf("%02d", k%16+1),
+		})
+	}
+	day := time.Date(2021, 12, 2, 0, 0, 0, 0, time.UTC)
+	for n := 140; n <= 153; n++ {
+		add(fmt.Sprintf("2021%03d", n), day, n)
+		day = day.AddDate(0, 0, 2)
+	}
+	for n := 1; n <= 10; n++ {
+		add(fmt.Sprintf("2022%03d", n), day, n)
+		day = day.AddDate(0, 0, 2)
+	}
+	return items
+}
+
+// newBackfillSource 每页 4 期的数据源，逼出多页请求
+func newBackfillSource(fake *fakeCwlServer) *cwlDrawSource {
+	source := newCwlDrawSource(fake.URL, "ssq", 0)
+	source.pageSize = 4
+	return source
+}
+
+// drawCodes 库中某个玩法的全部期号，按期号升序
+func drawCodes(t *testing.T, store *LotteryStore, game string) []string {
+	draws, err := store.ListDraws(game)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	for _, draw := range draws {
+		codes = append(codes, draw.Code)
+	}
+	return codes
+}
+
+func TestBackfillDrawsPagesThroughEachYear(t *testing.T) {
+	game, _ := gameByCode("ssq")
+	store := newTestStore(t)
+	fake := newFakeCwlServer(t, ssqFixtureItems())
+
+	saved, err := backfillDraws(store, game, newBackfillSource(fake), backfillOptions{IssueStart: "2021140", IssueEnd: "2022010"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved != 24 {
+		t.Errorf("应保存 24 期，实际 %d 期", saved)
+	}
+	codes := drawCodes(t, store, "ssq")
+	if len(codes) != 24 || codes[0] != "2021140" || codes[23] != "2022010" {
+		t.Errorf("入库的期号不对: %v", codes)
+	}
+
+	//2021 年 14 期分 4 页，2022 年 10 期分 3 页，每年的范围分开请求
+	var pages []string
+	for _, query := range fake.requests {
+		pages = append(pages, query.Get("issueStart")+"-"+query.Get("issueEnd")+"#"+query.Get("pageNo"))
+	}
+	want := []string{
+		"2021140-2021999#1", "2021140-2021999#2", "2021140-2021999#3", "2021140-2021999#4",
+		"2022001-2022010#1", "2022001-2022010#2", "2022001-2022010#3",
+	}
+	if fmt.Sprint(pages) != fmt.Sprint(want) {
+		t.Errorf("分页请求为 %v，应为 %v", pages, want)
+	}
+}
+
+func TestBackfillDrawsResumesFromLatestDraw(t *testing.T) {
+	game, _ := gameByCode("ssq")
+	store := newTestStore(t)
+	fake := newFakeCwlServer(t, ssqFixtureItems())
+	source := newBackfillSource(fake)
+
+	//2022 年的第二页出错：2021 年已整年提交，2022 年一期都不保存
+	fake.fail = func(query url.Values) bool {
+		return query.Get("issueStart") == "2022001" && query.Get("pageNo") == "2"
+	}
+	saved, err := backfillDraws(store, game, source, backfillOptions{IssueStart: "2021140", IssueEnd: "2022010"})
+	if err == nil {
+		t.Fatal("官网出错时应返回错误")
+	}
+	if saved != 14 {
+		t.Errorf("出错前应保存 2021 年的 14 期，实际 %d 期", saved)
+	}
+	if latest, _ := store.LatestDrawCode("ssq"); latest != "2021153" {
+		t.Errorf("出错后库中最新一期应为 2021153，实际 %s", latest)
+	}
+
+	//不指定起始期号，从库中最新一期续传
+	fake.fail = nil
+	before := fake.requestCount()
+	saved, err = backfillDraws(store, game, source, backfillOptions{IssueEnd: "2022010"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved != 11 {
+		t.Errorf("续传应保存 2021153 和 2022 年的 10 期共 11 期，实际 %d 期", saved)
+	}
+	if first := fake.requests[before]; first.Get("issueStart") != "2021153" {
+		t.Errorf("续传应从 2021153 开始，实际从 %s 开始", first.Get("issueStart"))
+	}
+	if codes := drawCodes(t, store, "ssq"); len(codes) != 24 {
+		t.Errorf("续传后应有 24 期，实际 %d 期", len(codes))
+	}
+}
+
+func TestBackfillDrawsIsIdempotent(t *testing.T) {
+	game, _ := gameByCode("ssq")
+	store := newTestStore(t)
+	fake := newFakeCwlServer(t, ssqFixtureItems())
+	source := newBackfillSource(fake)
+	opts := backfillOptions{IssueStart: "2021140", IssueEnd: "2022010"}
+
+	if _, err := backfillDraws(store, game, source, opts); err != nil {
+		t.Fatal(err)
+	}
+	first, err := store.ListDraws("ssq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = backfillDraws(store, game, source, opts); err != nil {
+		t.Fatal(err)
+	}
+	//按日期范围再回补一遍重叠的期
+	if _, err = backfillDraws(store, game, source, backfillOptions{DayStart: "2021-12-20", DayEnd: "2022-01-10"}); err != nil {
+		t.Fatal(err)
+	}
+	second, err := store.ListDraws("ssq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second) != len(first) {
+		t.Fatalf("重复回补后应仍为 %d 期，实际 %d 期", len(first), len(second))
+	}
+	for i := range first {
+		if first[i].Code != second[i].Code || first[i].Red != second[i].Red || first[i].Blue != second[i].Blue {
+			t.Errorf("重复回补后第 %s 期变为 %+v", first[i].Code, second[i])
+		}
+	}
+}
+
+func TestBackfillDrawsByDayRange(t *testing.T) {
+	game, _ := gameByCode("ssq")
+	store := newTestStore(t)
+	fake := newFakeCwlServer(t, ssqFixtureItems())
+
+	//2021-12-28 到 2022-01-05 之间开奖的为 2021153 和 2022001-2022004 期
+	saved, err := backfillDraws(store, game, newBackfillSource(fake), backfillOptions{DayStart: "2021-12-28", DayEnd: "2022-01-05"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := drawCodes(t, store, "ssq")
+	if saved != len(codes) || fmt.Sprint(codes) != "[2021153 2022001 2022002 2022003 2022004]" {
+		t.Errorf("按日期回补的期号为 %v（保存 %d 期）", codes, saved)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// backtestBaseline 均匀随机的基准，每个区按相同的权重选号
+const backtestBaseline = "uniform"
+
+// backtestOptions 回测的参数
+type backtestOptions struct {
+	Strategies []string
+	Play       string
+	Tickets    int    // 每期每种生成方式生成的注数
+	IssueStart string // 为空时从第 MinTrain+1 期开始
+	IssueEnd   string
+	MinTrain   int // 至少用多少期历史数据训练
+	Seed       int64
+}
+
+// backtestStats 一种生成方式的回测结果
+type backtestStats struct {
+	Strategy string
+	Issues   int
+	Bets     int
+	WinBets  int
+	Tiers    map[int]int // 奖级 -> 中奖注数
+	Prize    int64       // 分
+}
+
+// Cost 投入，分
+func (b *backtestStats) Cost() int64 {
+	return int64(b.Bets) * ticketPrice
+}
+
+// HitRate 中奖注数占全部注数的比例
+func (b *backtestStats) HitRate() float64 {
+	if b.Bets == 0 {
+		return 0
+	}
+	return float64(b.WinBets) / float64(b.Bets)
+}
+
+// ExpectedValue 平均每注的奖金，元
+func (b *backtestStats) ExpectedValue() float64 {
+	if b.Bets == 0 {
+		return 0
+	}
+	return fenToYuan(b.Prize) / float64(b.Bets)
+}
+
+// ROI 回报率，(奖金-投入)/投入
+func (b *backtestStats) ROI() float64 {
+	if b.Bets == 0 {
+		return 0
+	}
+	return float64(b.Prize-b.Cost()) / float64(b.Cost())
+}
+
+// runBacktest 解析 backtest 子命令的参数，回测后输出报告
+//
+//	LotteryServer backtest [-game ssq] [-strategy markov,markov:order=2&smoothing=1,hot] [-tickets 5] [-issue-start 2020001] [-issue-end 2020150] [-min-train 100] [-seed 1]
+func runBacktest(store *LotteryStore, args []string) error {
+	fs := flag.NewFlagSet("backtest", flag.ContinueOnError)
+	var opts backtestOptions
+	gameCode := fs.String("game", defaultGameCode, "玩法：ssq、dlt、3d、qlc、kl8")
+	strategies := fs.String("strategy", "", "参与回测的生成方式，逗号分隔，可以用 名称:参数 指定参数，如 markov:order=2&positional=1，为空时为 random 以外的全部生成方式")
+	fs.StringVar(&opts.Play, "play", "", "投注方式，为空时为该玩法默认的投注方式")
+	fs.IntVar(&opts.Tickets, "tickets", 5, "每期每种生成方式生成的注数")
+	fs.StringVar(&opts.IssueStart, "issue-start", "", "起始期号，为空时从有足够训练数据的一期开始")
+	fs.StringVar(&opts.IssueEnd, "issue-end", "", "结束期号，为空表示到最新一期")
+	fs.IntVar(&opts.MinTrain, "min-train", 100, "至少用多少期历史开奖训练")
+	fs.Int64Var(&opts.Seed, "seed", 1, "随机数种子，相同的种子和数据得到相同的结果")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	game, err := gameByCode(*gameCode)
+	if err != nil {
+		return err
+	}
+	if opts.Play, err = gamePlay(game, opts.Play); err != nil {
+		return err
+	}
+	if *strategies != "" {
+		opts.Strategies = strings.Split(*strategies, ",")
+	} else {
+		for _, g := range allGenerators() {
+			if g.Name() != "random" {
+				opts.Strategies = append(opts.Strategies, g.Name())
+			}
+		}
+	}
+
+	draws, err := store.ListDraws(game.Code())
+	if err != nil {
+		return err
+	}
+	results, err := backtest(game, draws, opts)
+	if err != nil {
+		return err
+	}
+	printBacktest(game, opts, results)
+	return nil
+}
+
+// backtest 按期号逐期回放开奖历史：每一期只用之前的开奖训练各生成方式，生成若干注号码后按当期规则计奖
+// 第一个结果是均匀随机的基准，其余按 opts.Strategies 的顺序
+func backtest(game Game, draws []Draw, opts backtestOptions) ([]*backtestStats, error) {
+	if opts.Tickets < 1 {
+		return nil, fmt.Errorf("每期注数应大于0")
+	}
+	var generatorList []Generator
+	var paramsList []map[string]int
+	for _, strategy := range opts.Strategies {
+		name := strings.TrimSpace(strategy)
+		value := ""
+		if i := strings.Index(name, ":"); i >= 0 {
+			name, value = name[:i], name[i+1:]
+		}
+		g, err := generatorByName(name)
+		if err != nil {
+			return nil, err
+		}
+		params, err := parseParams(g, value)
+		if err != nil {
+			return nil, err
+		}
+		generatorList = append(generatorList, g)
+		paramsList = append(paramsList, params)
+	}
+
+	//开奖号码格式错误的期跳过，不参与训练也不参与回测
+	var history []Ticket
+	var historyDraws []Draw
+	for _, draw := range draws {
+		numbers, err := game.DrawNumbers(draw)
+		if err != nil {
+			fmt.Println("跳过第", draw.Code, "期:", err)
+			continue
+		}
+		history = append(history, numbers)
+		historyDraws = append(historyDraws, draw)
+	}
+
+	results := []*backtestStats{{Strategy: backtestBaseline, Tiers: make(map[int]int)}}
+	for _, strategy := range opts.Strategies {
+		results = append(results, &backtestStats{Strategy: strings.TrimSpace(strategy), Tiers: make(map[int]int)})
+	}
+
+	//模型只含当期之前的开奖号码，每期计奖后再增量加入当期的号码
+	model := NewModel(nil, "")
+	r := newRand(opts.Seed)
+	for k, draw := range historyDraws {
+		if opts.IssueEnd != "" && draw.Code > opts.IssueEnd {
+			break
+		}
+		if k < opts.MinTrain || (opts.IssueStart != "" && draw.Code < opts.IssueStart) {
+			model.add(history[k], draw)
+			continue
+		}
+
+		for i, stats := range results {
+			for n := 0; n < opts.Tickets; n++ {
+				var ticket Ticket
+				var err error
+				if i == 0 {
+					ticket, err = weightedTicket(game, TicketRequest{Play: opts.Play}, r, func(int, Zone) map[int]float64 { return nil })
+				} else {
+					g := generatorList[i-1]
+					ticket, err = g.Generate(game, model, TicketRequest{Strategy: g.Name(), Params: paramsList[i-1], Play: opts.Play}, r)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("第%s期%s生成号码失败: %w", draw.Code, stats.Strategy, err)
+				}
+
+				result := gradeNumbers(game, ticket, history[k], draw)
+				stats.Bets += ticketBets(game, ticket)
+				stats.Prize += result.PrizeMoney
+				for _, tier := range result.Tiers {
+					stats.Tiers[tier.PrizeGrade] += tier.BetCount
+					stats.WinBets += tier.BetCount
+				}
+			}
+			stats.Issues++
+		}
+		model.add(history[k], draw)
+	}
+	if results[0].Issues == 0 {
+		return nil, fmt.Errorf("%s没有可以回测的期，开奖数据共%d期，至少需要训练%d期", game.Name(), len(historyDraws), opts.MinTrain)
+	}
+	return results, nil
+}
+
+// printBacktest 按生成方式输出各奖级中奖注数、中奖率、平均每注奖金和回报率，并和均匀随机的基准比较
+func printBacktest(game Game, opts backtestOptions, results []*backtestStats) {
+	baseline := results[0]
+	fmt.Printf("%s回测：共%d期，每期每种生成方式%d注，种子 %d\n", game.Name(), baseline.Issues, opts.Tickets, opts.Seed)
+
+	grades := make(map[int]bool)
+	for _, stats := range results {
+		for grade := range stats.Tiers {
+			grades[grade] = true
+		}
+	}
+	var gradeList []int
+	for grade := range grades {
+		gradeList = append(gradeList, grade)
+	}
+	sort.Ints(gradeList)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := []string{"生成方式", "注数"}
+	for _, grade := range gradeList {
+		header = append(header, fmt.Sprintf("%d等奖", grade))
+	}
+	header = append(header, "中奖率", "每注期望(元)", "回报率", "中奖率/基准", "期望-基准(元)")
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+
+	for _, stats := range results {
+		row := []string{stats.Strategy, fmt.Sprint(stats.Bets)}
+		for _, grade := range gradeList {
+			row = append(row, fmt.Sprint(stats.Tiers[grade]))
+		}
+		ratio := "-"
+		if baseline.HitRate() > 0 {
+			ratio = fmt.Sprintf("%.3f", stats.HitRate()/baseline.HitRate())
+		}
+		row = append(row,
+			fmt.Sprintf("%.4f%%", stats.HitRate()*100),
+			fmt.Sprintf("%.4f", stats.ExpectedValue()),
+			fmt.Sprintf("%.2f%%", stats.ROI()*100),
+			ratio,
+			fmt.Sprintf("%+.4f", stats.ExpectedValue()-baseline.ExpectedValue()),
+		)
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// maxBatchCount 一次最多生成的注数
+const maxBatchCount = 100
+
+// batchAttempts 批量生成时每注最多尝试的次数，超过后认为条件无法满足
+const batchAttempts = 200
+
+// BatchTicket 批量生成的一注号码
+type BatchTicket struct {
+	Id      int64  `json:"id"`
+	Lottery string `json:"lottery"`
+	Bets    int    `json:"bets"`
+}
+
+// BatchResult 批量生成的结果
+type BatchResult struct {
+	Game      string         `json:"game"`
+	Strategy  string         `json:"strategy"`
+	IssueCode string         `json:"issueCode"`
+	Tickets   []BatchTicket  `json:"tickets"`
+	Skipped   []SkippedNonce `json:"skipped,omitempty"` // 带 clientSeed 时被淘汰的号码占用的 nonce
+}
+
+// lotteryBatch 一次生成 count 注互不相同的号码并在同一个事务中保存
+// distance 为任意两注之间至少不同的号码个数；和已生成过的号码或历史开奖号码相同的号码都会重新生成，
+// 带 clientSeed 时被淘汰的号码已经占用了 nonce，记录到 skipped_nonces 并随结果返回
+func (s *server) lotteryBatch(w http.ResponseWriter, r *http.Request, game Game, req TicketRequest, random RandomSource, issueCode string) {
+	count, err := strconv.Atoi(r.Form.Get("count"))
+	if err != nil || count < 1 || count > maxBatchCount {
+		http.Error(w, fmt.Sprintf("count参数应为1到%d", maxBatchCount), http.StatusBadRequest)
+		return
+	}
+	distance := 0
+	if value := r.Form.Get("distance"); value != "" {
+		if distance, err = strconv.Atoi(value); err != nil || distance < 0 {
+			http.Error(w, "distance参数错误", http.StatusBadRequest)
+			return
+		}
+	}
+
+	existing, err := s.store.TicketNumbers(game.Code())
+	if err != nil {
+		fmt.Println("查询已生成号码失败:", err)
+		http.Error(w, "查询已生成号码失败", http.StatusInternalServerError)
+		return
+	}
+	draws := s.models.History(game)
+
+	var tickets []Ticket
+	var provenances []Provenance
+	var skipped []SkippedNonce
+	for attempts := 0; len(tickets) < count && attempts < count*batchAttempts; attempts++ {
+		ticket, provenance, err := s.generateTicket(game, req, random)
+		if err != nil {
+			fmt.Println("生成号码失败:", err)
+			http.Error(w, "生成号码失败", http.StatusInternalServerError)
+			return
+		}
+		numbers := game.FormatTicket(ticket)
+		reason := ""
+		if existing[numbers] {
+			reason = "和已生成的号码相同"
+		} else if drawnBefore(ticket, draws) {
+			reason = "和历史开奖号码相同"
+		} else if !farFrom(ticket, tickets, distance) {
+			reason = fmt.Sprintf("和本批号码不同的号码少于%d个", distance)
+		}
+		if reason != "" {
+			if provenance.Entropy == "hmac" {
+				skipped = append(skipped, SkippedNonce{Nonce: provenance.Nonce, Numbers: numbers, Reason: reason})
+			}
+			continue
+		}
+		existing[numbers] = true
+		tickets = append(tickets, ticket)
+		provenances = append(provenances, provenance)
+	}
+	if len(tickets) < count {
+		//注数不足时一注都不保存，已选中的号码也记为跳过
+		for i, ticket := range tickets {
+			if provenances[i].Entropy == "hmac" {
+				skipped = append(skipped, SkippedNonce{Nonce: provenances[i].Nonce, Numbers: game.FormatTicket(ticket), Reason: "注数不足，没有保存"})
+			}
+		}
+		if !s.saveSkippedNonces(w, game, random, skipped) {
+			return
+		}
+		http.Error(w, fmt.Sprintf("只生成了%d注满足条件的号码，请减少注数或距离", len(tickets)), http.StatusUnprocessableEntity)
+		return
+	}
+	if !s.saveSkippedNonces(w, game, random, skipped) {
+		return
+	}
+
+	result := BatchResult{Game: game.Code(), Strategy: req.Strategy, IssueCode: issueCode, Skipped: skipped}
+	records := make([]TicketRecord, len(tickets))
+	for i, ticket := range tickets {
+		records[i] = newTicketRecord(game, req, ticket, provenances[i])
+	}
+	ids, err := s.store.InsertLotterys(game.Code(), issueCode, records)
+	if err != nil {
+		fmt.Println("保存号码失败:", err)
+		http.Error(w, "保存号码失败", http.StatusInternalServerError)
+		return
+	}
+	for i, record := range records {
+		result.Tickets = append(result.Tickets, BatchTicket{Id: ids[i], Lottery: record.Numbers, Bets: record.Bets})
+	}
+	fmt.Println("批量新增", len(ids), "注", game.Name(), "期号:", issueCode)
+
+	bts, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "序列化生成结果失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bts)
+}
+
+// saveSkippedNonces 保存被跳过的 nonce，失败时返回错误响应并返回 false
+func (s *server) saveSkippedNonces(w http.ResponseWriter, game Game, random RandomSource, skipped []SkippedNonce) bool {
+	fair, ok := random.(*fairRandom)
+	if !ok || len(skipped) == 0 {
+		return true
+	}
+	if err := s.store.SaveSkippedNonces(game.Code(), fair.issueCode, fair.clientSeed, skipped); err != nil {
+		fmt.Println("保存跳过的 nonce 失败:", err)
+		http.Error(w, "保存跳过的 nonce 失败", http.StatusInternalServerError)
+		return false
+	}
+	fmt.Println(game.Name(), "期号:", fair.issueCode, "批量生成跳过", len(skipped), "个 nonce")
+	return true
+}
+
+// ticketDistance 两注号码之间不同的号码个数，各区分别计算后相加
+// 只比较两注都有的区，胆码并入第一个区
+func ticketDistance(a Ticket, b Ticket) int {
+	a, b = a.withoutBankers(), b.withoutBankers()
+	distance := 0
+	for i := range a.Zones {
+		if i >= len(b.Zones) {
+			break
+		}
+		size := len(a.Zones[i])
+		if len(b.Zones[i]) > size {
+			size = len(b.Zones[i])
+		}
+		distance += size - countHits(a.Zones[i], b.Zones[i])
+	}
+	return distance
+}
+
+// drawnBefore 号码是否和某一期的开奖号码完全相同
+func drawnBefore(ticket Ticket, draws []Ticket) bool {
+	for _, draw := range draws {
+		if ticketDistance(ticket, draw) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// farFrom 号码和已选的每一注之间是否至少有 distance 个号码不同
+func farFrom(ticket Ticket, picked []Ticket, distance int) bool {
+	for _, other := range picked {
+		if ticketDistance(ticket, other) < distance {
+			return false
+		}
+	}
+	return true
+}
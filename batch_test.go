@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatchRejection(t *testing.T) {
+	game, _ := gameByCode("ssq")
+	parse := func(numbers string) Ticket {
+		ticket, err := game.ParseTicket("", numbers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ticket
+	}
+	a := parse("01 02 03 04 05 06 07")
+	b := parse("01 02 03 04 05 16 08")
+	if d := ticketDistance(a, b); d != 2 {
+		t.Errorf("红球差 1 个、蓝球不同，距离应为 2，实际 %d", d)
+	}
+	if !farFrom(b, []Ticket{a}, 2) || farFrom(b, []Ticket{a}, 3) {
+		t.Error("距离为 2 时应满足 distance=2、不满足 distance=3")
+	}
+	history := []Ticket{parse("06 05 04 03 02 01 07"), b}
+	if !drawnBefore(a, history) || drawnBefore(parse("01 02 03 04 05 06 08"), history) {
+		t.Error("只有和某期开奖号码完全相同时才算开出过")
+	}
+}
+
+// postBatch 直接调用 lotteryBatch，时间固定在开售期间
+func postBatch(t *testing.T, s *server, game Game, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/lottery", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.ParseForm()
+	w := httptest.NewRecorder()
+	req, err := requestTicket(game, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issueCode, err := s.store.targetIssueCode(game, time.Date(2022, 2, 8, 10, 0, 0, 0, beijing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	random, err := s.requestRandom(game, r, issueCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.lotteryBatch(w, r, game, req, random, issueCode)
+	return w
+}
+
+// TestBatchRecordsSkippedNonces 带 clientSeed 批量生成时，保存的号码和跳过的 nonce 合起来正好是 0 到最后一个 nonce
+func TestBatchRecordsSkippedNonces(t *testing.T) {
+	game, _ := gameByCode("kl8")
+	store := newTestStore(t)
+	s := &server{store: store, models: newModelCache()}
+
+	//选一只有 80 种号码，60 注里必然有重复的被淘汰
+	w := postBatch(t, s, game, url.Values{"game": {"kl8"}, "play": {"x1"}, "strategy": {"random"}, "count": {"60"}, "clientSeed": {"abc"}})
+	if w.Code != 200 {
+		t.Fatalf("批量生成失败: %d %s", w.Code, w.Body.String())
+	}
+	var result BatchResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Tickets) != 60 || len(result.Skipped) == 0 {
+		t.Fatalf("应生成 60 注并跳过一些重复的号码，实际 %d 注、跳过 %d 个", len(result.Tickets), len(result.Skipped))
+	}
+
+	used := make(map[int64]bool)
+	for _, item := range result.Tickets {
+		ticket, err := store.GetTicket(item.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		used[ticket.Provenance.Nonce] = true
+		//号码的期号和取 nonce 的服务端种子是同一期
+		if ticket.IssueCode != result.IssueCode {
+			t.Errorf("号码 %d 的期号为 %s，服务端种子为 %s 期", item.Id, ticket.IssueCode, result.IssueCode)
+		}
+	}
+	if n := countRows(t, store, "select count(*) from server_seeds where game='kl8' and issue_code=?;", result.IssueCode); n != 1 {
+		t.Errorf("%s 期应有服务端种子", result.IssueCode)
+	}
+	for _, item := range result.Skipped {
+		if used[item.Nonce] || item.Reason == "" {
+			t.Errorf("跳过的 nonce %d 重复或没有原因: %+v", item.Nonce, item)
+		}
+		used[item.Nonce] = true
+	}
+	_, next, err := store.NextNonce("kl8", result.IssueCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(used)) != next {
+		t.Errorf("取过 %d 个 nonce，保存和跳过的合计 %d 个", next, len(used))
+	}
+	if n := countRows(t, store, "select count(*) from skipped_nonces where game='kl8' and issue_code=? and client_seed='abc';", result.IssueCode); n != len(result.Skipped) {
+		t.Errorf("库中应记录 %d 个跳过的 nonce，实际 %d 个", len(result.Skipped), n)
+	}
+}
+
+func TestBatchUnsatisfiable(t *testing.T) {
+	game, _ := gameByCode("ssq")
+	store := newTestStore(t)
+	s := &server{store: store, models: newModelCache()}
+
+	//双色球两注之间最多 7 个号码不同
+	w := postBatch(t, s, game, url.Values{"game": {"ssq"}, "strategy": {"random"}, "count": {"2"}, "distance": {"8"}, "clientSeed": {"abc"}})
+	if w.Code != 422 {
+		t.Fatalf("条件无法满足时应返回 422，实际 %d %s", w.Code, w.Body.String())
+	}
+	if n := countRows(t, store, "select count(*) from tickets;"); n != 0 {
+		t.Errorf("注数不足时不应保存号码，实际保存 %d 注", n)
+	}
+	//每个取过的 nonce 都记为跳过，包括选中但没有保存的第一注
+	if n := countRows(t, store, "select count(*) from skipped_nonces;"); n != 2*batchAttempts {
+		t.Errorf("应记录 %d 个跳过的 nonce，实际 %d 个", 2*batchAttempts, n)
+	}
+	if n := countRows(t, store, "select count(*) from skipped_nonces where reason='注数不足，没有保存';"); n != 1 {
+		t.Errorf("选中但没有保存的应为 1 注，实际 %d 注", n)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+)
+
+// beijing 开奖时间、停售时间都以北京时间为准
+var beijing = time.FixedZone("CST", 8*3600)
+
+// Suspension 一段休市日期（含首尾），如春节休市
+type Suspension struct {
+	Start  string `json:"start"`
+	End    string `json:"end"`
+	Reason string `json:"reason"`
+}
+
+// DrawCalendar 开奖日历：每周固定几天开奖，开奖当天到点停售，休市期间不开奖
+type DrawCalendar struct {
+	weekdays     []time.Weekday
+	drawHour     int
+	drawMinute   int
+	cutoffHour   int
+	cutoffMinute int
+	suspended    map[string]string // 2006-01-02 -> 休市原因
+}
+
+// everyDay 每天开奖的玩法，如福彩3D、快乐8
+var everyDay = []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}
+
+// newDrawCalendar 每周 weekdays 这几天的 drawHour:drawMinute 开奖，开奖当天 cutoffHour:cutoffMinute 停售
+// 如双色球每周二、四、日 21:15 开奖，大乐透每周一、三、六 21:25 开奖，都是当天 20:00 停售
+func newDrawCalendar(weekdays []time.Weekday, drawHour, drawMinute, cutoffHour, cutoffMinute int) *DrawCalendar {
+	return &DrawCalendar{
+		weekdays:     weekdays,
+		drawHour:     drawHour,
+		drawMinute:   drawMinute,
+		cutoffHour:   cutoffHour,
+		cutoffMinute: cutoffMinute,
+		suspended:    make(map[string]string),
+	}
+}
+
+// LoadSuspensions 从 JSON 文件读取休市日期，文件不存在时不做任何事
+func (c *DrawCalendar) LoadSuspensions(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var suspensions []Suspension
+	if err = json.Unmarshal(content, &suspensions); err != nil {
+		return fmt.Errorf("解析休市日期 %s 失败: %w", path, err)
+	}
+	for _, sp := range suspensions {
+		if err = c.AddSuspension(sp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddSuspension 增加一段休市日期
+func (c *DrawCalendar) AddSuspension(sp Suspension) error {
+	start, err := time.ParseInLocation("2006-01-02", sp.Start, beijing)
+	if err != nil {
+		return fmt.Errorf("休市开始日期 %q 格式错误: %w", sp.Start, err)
+	}
+	end := start
+	if sp.End != "" {
+		if end, err = time.ParseInLocation("2006-01-02", sp.End, beijing); err != nil {
+			return fmt.Errorf("休市结束日期 %q 格式错误: %w", sp.End, err)
+		}
+	}
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		c.suspended[day.Format("2006-01-02")] = sp.Reason
+	}
+	return nil
+}
+
+// IsSuspended 判断某天是否休市
+func (c *DrawCalendar) IsSuspended(t time.Time) bool {
+	_, ok := c.suspended[t.In(beijing).Format("2006-01-02")]
+	return ok
+}
+
+// IsDrawDay 判断某天是否开奖：是固定开奖的星期几且不在休市期间
+func (c *DrawCalendar) IsDrawDay(t time.Time) bool {
+	t = t.In(beijing)
+	if c.IsSuspended(t) {
+		return false
+	}
+	for _, w := range c.weekdays {
+		if t.Weekday() == w {
+			return true
+		}
+	}
+	return false
+}
+
+// drawTimeOn 返回某天的开奖时间
+func (c *DrawCalendar) drawTimeOn(day time.Time) time.Time {
+	y, m, d := day.In(beijing).Date()
+	return time.Date(y, m, d, c.drawHour, c.drawMinute, 0, 0, beijing)
+}
+
+// cutoffOn 返回某天的停售时间
+func (c *DrawCalendar) cutoffOn(day time.Time) time.Time {
+	y, m, d := day.In(beijing).Date()
+	return time.Date(y, m, d, c.cutoffHour, c.cutoffMinute, 0, 0, beijing)
+}
+
+// SalesOpen 判断 t 时刻能否购买：休市期间以及开奖日停售到开奖之间不能购买
+func (c *DrawCalendar) SalesOpen(t time.Time) bool {
+	if c.IsSuspended(t) {
+		return false
+	}
+	if c.IsDrawDay(t) && !t.Before(c.cutoffOn(t)) && t.Before(c.drawTimeOn(t)) {
+		return false
+	}
+	return true
+}
+
+// TargetDrawDay 返回 t 时刻购买的号码参与的开奖日（零点）：开奖日停售之前算当天，否则顺延到下一个开奖日
+// 和 drawSchedule.Next 一样最多找到下一年年底，找不到说明休市配置有误
+func (c *DrawCalendar) TargetDrawDay(t time.Time) (time.Time, error) {
+	t = t.In(beijing)
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, beijing)
+	if c.IsDrawDay(day) && t.Before(c.cutoffOn(day)) {
+		return day, nil
+	}
+	for day = day.AddDate(0, 0, 1); day.Year() <= y+1; day = day.AddDate(0, 0, 1) {
+		if c.IsDrawDay(day) {
+			return day, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%s之后一年内没有开奖日，请检查休市配置", t.Format("2006-01-02"))
+}
+
+// CountDrawDays 统计 (from, to] 之间的开奖日数量
+func (c *DrawCalendar) CountDrawDays(from time.Time, to time.Time) int {
+	y, m, d := from.In(beijing).Date()
+	n := 0
+	for day := time.Date(y, m, d, 0, 0, 0, 0, beijing).AddDate(0, 0, 1); !day.After(to); day = day.AddDate(0, 0, 1) {
+		if c.IsDrawDay(day) {
+			n++
+		}
+	}
+	return n
+}
+
+// IssueCodeOn 返回某个开奖日的期号：年份加当年第几个开奖日
+func (c *DrawCalendar) IssueCodeOn(day time.Time) string {
+	day = day.In(beijing)
+	yearStart := time.Date(day.Year(), time.January, 1, 0, 0, 0, 0, beijing)
+	return fmt.Sprintf("%d%03d", day.Year(), c.CountDrawDays(yearStart.AddDate(0, 0, -1), day))
+}
+
+// NextIssue 返回 t 时刻购买的号码参与的期号及开奖时间
+func (c *DrawCalendar) NextIssue(t time.Time) (string, time.Time, error) {
+	day, err := c.TargetDrawDay(t)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return c.IssueCodeOn(day), c.drawTimeOn(day), nil
+}
+
+// DrawTime 返回期号对应的开奖时间
+func (c *DrawCalendar) DrawTime(code string) (time.Time, error) {
+	year, err := issueYear(code)
+	if err != nil {
+		return time.Time{}, err
+	}
+	seq, err := strconv.Atoi(code[4:])
+	if err != nil || seq <= 0 {
+		return time.Time{}, fmt.Errorf("期号格式错误: %s", code)
+	}
+
+	n := 0
+	for day := time.Date(year, time.January, 1, 0, 0, 0, 0, beijing); day.Year() == year; day = day.AddDate(0, 0, 1) {
+		if c.IsDrawDay(day) {
+			n++
+			if n == seq {
+				return c.drawTimeOn(day), nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("%d年没有第%d期", year, seq)
+}
+
+// drawSchedule 实现 cron.Schedule，在每次实际开奖之后 delay 触发，休市期间不触发
+type drawSchedule struct {
+	calendar *DrawCalendar
+	delay    time.Duration
+}
+
+func (d drawSchedule) Next(t time.Time) time.Time {
+	y, m, day := t.In(beijing).Date()
+	for date := time.Date(y, m, day, 0, 0, 0, 0, beijing); date.Year() <= y+1; date = date.AddDate(0, 0, 1) {
+		if !d.calendar.IsDrawDay(date) {
+			continue
+		}
+		if next := d.calendar.drawTimeOn(date).Add(d.delay); next.After(t) {
+			return next
+		}
+	}
+	//一年之内都没有开奖日，说明休市配置有误，不再触发
+	return time.Time{}
+}
+
+// targetIssueCode 计算 t 时刻购买的号码参与的期号
+// 以库中该开奖日之前最近的一期为基准往后数开奖日，休市配置不完整时误差只会出现在最近一次休市之后；
+// 基准不在同一年或库里没有开奖结果时按开奖日历从当年第一期开始数
+func (s *LotteryStore) targetIssueCode(game Game, t time.Time) (string, error) {
+	calendar := game.Calendar()
+	drawDay, err := calendar.TargetDrawDay(t)
+	if err != nil {
+		return "", err
+	}
+
+	var code, drawDate sql.NullString
+	err = s.db.QueryRow("select code, draw_date from draws where game=? and draw_date < ? order by code desc limit 1;",
+		game.Code(), drawDay.Format("2006-01-02")).Scan(&code, &drawDate)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("查询最近一期开奖结果失败: %w", err)
+	}
+
+	if code.Valid && drawDate.Valid {
+		anchorDay, err := time.ParseInLocation("2006-01-02", drawDate.String, beijing)
+		//issueYear 保证期号至少 5 位，之后才能取 code.String[4:]
+		if year, yerr := issueYear(code.String); err == nil && yerr == nil {
+			seq, serr := strconv.Atoi(code.String[4:])
+			if serr == nil && anchorDay.Year() == drawDay.Year() && year == drawDay.Year() {
+				return fmt.Sprintf("%d%03d", year, seq+calendar.CountDrawDays(anchorDay, drawDay)), nil
+			}
+		}
+	}
+
+	return calendar.IssueCodeOn(drawDay), nil
+}
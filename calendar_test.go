@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTargetDrawDay(t *testing.T) {
+	c := newDrawCalendar([]time.Weekday{time.Tuesday, time.Thursday, time.Sunday}, 21, 15, 20, 0)
+	if err := c.AddSuspension(Suspension{Start: "2022-01-31", End: "2022-02-06", Reason: "春节"}); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		now  time.Time
+		want string
+	}{
+		// 周二停售前算当天，停售后顺延到周四
+		{time.Date(2022, 1, 25, 19, 59, 0, 0, beijing), "2022-01-25"},
+		{time.Date(2022, 1, 25, 20, 0, 0, 0, beijing), "2022-01-27"},
+		// 春节休市顺延到休市后第一个开奖日
+		{time.Date(2022, 1, 30, 20, 30, 0, 0, beijing), "2022-02-08"},
+	}
+	for _, cs := range cases {
+		day, err := c.TargetDrawDay(cs.now)
+		if err != nil || day.Format("2006-01-02") != cs.want {
+			t.Errorf("%v 购买应参与 %s 开奖，实际 %v %v", cs.now, cs.want, day, err)
+		}
+	}
+
+	//休市配置错误，之后一直休市
+	if err := c.AddSuspension(Suspension{Start: "2022-03-01", End: "2024-12-31"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.TargetDrawDay(time.Date(2022, 3, 1, 10, 0, 0, 0, beijing)); err == nil {
+		t.Error("一年内没有开奖日时应返回错误")
+	}
+}
+
+func TestTargetIssueCodeIgnoresMalformedCode(t *testing.T) {
+	game, _ := gameByCode("ssq")
+	store := newTestStore(t)
+	_, err := store.db.Exec(`insert into draws (game, code, draw_date, red, blue) values ('ssq', '202', '2022-02-06', '', '');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := store.targetIssueCode(game, time.Date(2022, 2, 8, 10, 0, 0, 0, beijing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := game.Calendar().IssueCodeOn(time.Date(2022, 2, 8, 0, 0, 0, 0, beijing)); code != want {
+		t.Errorf("期号格式错误时应按开奖日历计算为 %s，实际 %s", want, code)
+	}
+}
+
+// calendarGame 替换开奖日历的玩法，测试中不改动全局注册的玩法
+type calendarGame struct {
+	Game
+	calendar *DrawCalendar
+}
+
+func (g calendarGame) Calendar() *DrawCalendar { return g.calendar }
+
+// TestIssueCodeAcrossSpringFestival 按随附的 suspensions.json，春节休市前买的号码参与休市后的第一期
+func TestIssueCodeAcrossSpringFestival(t *testing.T) {
+	ssq, _ := gameByCode("ssq")
+	calendar := newDrawCalendar([]time.Weekday{time.Tuesday, time.Thursday, time.Sunday}, 21, 15, 20, 0)
+	if err := calendar.LoadSuspensions("suspensions.json"); err != nil {
+		t.Fatal(err)
+	}
+	game := calendarGame{Game: ssq, calendar: calendar}
+
+	//2022 年 1 月有 13 个开奖日，1 月 31 日至 2 月 6 日休市，2 月 8 日为第 14 期
+	breakDay := time.Date(2022, 2, 3, 10, 0, 0, 0, beijing)
+	if calendar.SalesOpen(breakDay) {
+		t.Error("春节休市期间不能购买")
+	}
+	if code := calendar.IssueCodeOn(time.Date(2022, 2, 8, 0, 0, 0, 0, beijing)); code != "2022014" {
+		t.Errorf("2022-02-08 应为 2022014 期，实际 %s", code)
+	}
+	if code, drawTime, err := calendar.NextIssue(breakDay); err != nil || code != "2022014" || drawTime.Format("2006-01-02") != "2022-02-08" {
+		t.Errorf("休市期间买的号码应参与 2022-02-08 的 2022014 期，实际 %s %v %v", code, drawTime, err)
+	}
+
+	//以库中 2022013 期为基准往后数开奖日
+	store := newTestStore(t)
+	items := loadFixture(t, ssq, "ssq_kjgg.json")
+	var before []KjggItem
+	for _, item := range items {
+		if item.Code <= "2022013" {
+			before = append(before, item)
+		}
+	}
+	if _, err := saveKjggItems(store, ssq, before); err != nil {
+		t.Fatal(err)
+	}
+	for _, now := range []time.Time{breakDay, time.Date(2022, 1, 30, 20, 30, 0, 0, beijing), time.Date(2022, 2, 8, 19, 0, 0, 0, beijing)} {
+		code, err := store.targetIssueCode(game, now)
+		if err != nil || code != "2022014" {
+			t.Errorf("%v 购买应参与 2022014 期，实际 %s %v", now, code, err)
+		}
+	}
+	if code, err := store.targetIssueCode(game, time.Date(2022, 2, 8, 20, 30, 0, 0, beijing)); err != nil || code != "2022015" {
+		t.Errorf("2022-02-08 停售后购买应参与 2022015 期，实际 %s %v", code, err)
+	}
+}
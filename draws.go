@@ -0,0 +1,215 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Draw 是 draws 表中的一期开奖结果
+type Draw struct {
+	Game        string
+	Code        string
+	DrawDate    string // 2022-02-08
+	Week        string
+	Red         string // 逗号分隔的两位数红球（大乐透为前区）
+	Blue        string // 逗号分隔的两位数蓝球（大乐透为后区）
+	Sales       sql.NullInt64
+	PoolMoney   sql.NullInt64
+	DetailsLink string
+	VideoLink   string
+	Content     string
+	AddMoney    string
+	AddMoney2   string
+	Zj1         string
+	Mj1         string
+	Zj6         string
+	Mj6         string
+	Z2Add       string
+	M2Add       string
+	Msg         string
+	PrizeGrades []PrizeGradesItem
+}
+
+// drawFromKjggItem 将开奖公告中的一期转换为入库的格式，号码统一为两位数
+func drawFromKjggItem(game Game, item KjggItem) (Draw, error) {
+	draw := Draw{
+		Game:        game.Code(),
+		Code:        strings.TrimSpace(item.Code),
+		DrawDate:    item.Date,
+		Week:        item.Week,
+		Sales:       parseMoney(item.Sales),
+		PoolMoney:   parseMoney(item.PoolMoney),
+		DetailsLink: item.DetailsLink,
+		VideoLink:   item.VideoLink,
+		Content:     item.Content,
+		AddMoney:    item.AddMoney,
+		AddMoney2:   item.AddMoney2,
+		Zj1:         item.Zj1,
+		Mj1:         item.Mj1,
+		Zj6:         item.Zj6,
+		Mj6:         item.Mj6,
+		Z2Add:       item.Z2Add,
+		M2Add:       item.M2Add,
+		Msg:         item.Msg,
+		PrizeGrades: item.PrizeGrades,
+	}
+	if draw.Code == "" {
+		return draw, fmt.Errorf("开奖公告缺少期号")
+	}
+	//公告里的日期形如 2022-02-08(二)
+	if idx := strings.Index(draw.DrawDate, "("); idx >= 0 {
+		draw.DrawDate = draw.DrawDate[:idx]
+	}
+
+	var err error
+	if draw.Red, err = normalizeNumbers(item.Red); err != nil {
+		return draw, fmt.Errorf("第%s期红球格式错误: %w", draw.Code, err)
+	}
+	//福彩3D 只有一组号码，blue 为空
+	if strings.TrimSpace(item.Blue) != "" {
+		if draw.Blue, err = normalizeNumbers(item.Blue); err != nil {
+			return draw, fmt.Errorf("第%s期蓝球格式错误: %w", draw.Code, err)
+		}
+	}
+	return draw, nil
+}
+
+// normalizeNumbers 将逗号分隔的号码统一格式化为两位数
+func normalizeNumbers(str string) (string, error) {
+	numbers, err := parseNumbers(str, ",")
+	if err != nil {
+		return "", err
+	}
+	if len(numbers) == 0 {
+		return "", fmt.Errorf("号码为空")
+	}
+	return formatNumbers(numbers, ","), nil
+}
+
+// formatNumbers 将号码格式化为两位数并以 sep 连接
+func formatNumbers(numbers []int, sep string) string {
+	strs := make([]string, len(numbers))
+	for i, n := range numbers {
+		strs[i] = fmt.Sprintf("%02d", n)
+	}
+	return strings.Join(strs, sep)
+}
+
+// parseMoney 解析公告中的金额、注数字段，小数部分舍去，空串、"---" 等无法解析的值返回 NULL
+func parseMoney(str string) sql.NullInt64 {
+	str = strings.Replace(strings.TrimSpace(str), ",", "", -1)
+	if idx := strings.Index(str, "."); idx >= 0 {
+		str = str[:idx]
+	}
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: n, Valid: true}
+}
+
+// UpsertDraws 按玩法和期号写入或更新开奖结果，包括各奖级的中奖注数和金额
+func (s *LotteryStore) UpsertDraws(draws []Draw) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, d := range draws {
+		_, err = tx.Exec(`insert into draws (game, code, draw_date, week, red, blue, sales, pool_money, details_link, video_link, content,
+			add_money, add_money2, zj1, mj1, zj6, mj6, z2add, m2add, msg)
+			values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			on conflict (game, code) do update set draw_date=excluded.draw_date, week=excluded.week, red=excluded.red, blue=excluded.blue,
+			sales=excluded.sales, pool_money=excluded.pool_money, details_link=excluded.details_link, video_link=excluded.video_link,
+			content=excluded.content, add_money=excluded.add_money, add_money2=excluded.add_money2, zj1=excluded.zj1, mj1=excluded.mj1,
+			zj6=excluded.zj6, mj6=excluded.mj6, z2add=excluded.z2add, m2add=excluded.m2add, msg=excluded.msg,
+			update_time=datetime('now', 'localtime');`,
+			d.Game, d.Code, d.DrawDate, d.Week, d.Red, d.Blue, d.Sales, d.PoolMoney, d.DetailsLink, d.VideoLink, d.Content,
+			d.AddMoney, d.AddMoney2, d.Zj1, d.Mj1, d.Zj6, d.Mj6, d.Z2Add, d.M2Add, d.Msg)
+		if err != nil {
+			return fmt.Errorf("保存第%s期开奖结果失败: %w", d.Code, err)
+		}
+
+		if _, err = tx.Exec("delete from draw_prize_grades where game=? and draw_code=?;", d.Game, d.Code); err != nil {
+			return fmt.Errorf("清理第%s期奖级信息失败: %w", d.Code, err)
+		}
+		for _, grade := range d.PrizeGrades {
+			_, err = tx.Exec("insert or replace into draw_prize_grades (game, draw_code, type, type_num, type_money) values (?, ?, ?, ?, ?);",
+				d.Game, d.Code, grade.Type, parseMoney(grade.TypeNum), parseMoney(grade.TypeMoney))
+			if err != nil {
+				return fmt.Errorf("保存第%s期奖级信息失败: %w", d.Code, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+const drawColumns = `game, code, draw_date, week, red, blue, sales, pool_money, details_link, video_link, content,
+	add_money, add_money2, zj1, mj1, zj6, mj6, z2add, m2add, msg`
+
+func scanDraw(scanner interface{ Scan(...interface{}) error }) (Draw, error) {
+	var d Draw
+	var drawDate, week, detailsLink, videoLink, content sql.NullString
+	var addMoney, addMoney2, zj1, mj1, zj6, mj6, z2add, m2add, msg sql.NullString
+	err := scanner.Scan(&d.Game, &d.Code, &drawDate, &week, &d.Red, &d.Blue, &d.Sales, &d.PoolMoney, &detailsLink, &videoLink, &content,
+		&addMoney, &addMoney2, &zj1, &mj1, &zj6, &mj6, &z2add, &m2add, &msg)
+	if err != nil {
+		return d, err
+	}
+	d.DrawDate, d.Week = drawDate.String, week.String
+	d.DetailsLink, d.VideoLink, d.Content = detailsLink.String, videoLink.String, content.String
+	d.AddMoney, d.AddMoney2, d.Msg = addMoney.String, addMoney2.String, msg.String
+	d.Zj1, d.Mj1, d.Zj6, d.Mj6, d.Z2Add, d.M2Add = zj1.String, mj1.String, zj6.String, mj6.String, z2add.String, m2add.String
+	return d, nil
+}
+
+// GetDraw 查询指定玩法、期号的开奖结果，不存在时返回 sql.ErrNoRows
+func (s *LotteryStore) GetDraw(game string, code string) (Draw, error) {
+	d, err := scanDraw(s.db.QueryRow("select "+drawColumns+" from draws where game=? and code=?;", game, code))
+	if err != nil {
+		return d, err
+	}
+
+	rows, err := s.db.Query("select type, type_num, type_money from draw_prize_grades where game=? and draw_code=? order by type;", game, code)
+	if err != nil {
+		return d, fmt.Errorf("查询第%s期奖级信息失败: %w", code, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var grade PrizeGradesItem
+		var typeNum, typeMoney sql.NullInt64
+		if err = rows.Scan(&grade.Type, &typeNum, &typeMoney); err != nil {
+			return d, fmt.Errorf("读取第%s期奖级信息失败: %w", code, err)
+		}
+		if typeNum.Valid {
+			grade.TypeNum = strconv.FormatInt(typeNum.Int64, 10)
+		}
+		if typeMoney.Valid {
+			grade.TypeMoney = strconv.FormatInt(typeMoney.Int64, 10)
+		}
+		d.PrizeGrades = append(d.PrizeGrades, grade)
+	}
+	return d, rows.Err()
+}
+
+// ListDraws 按期号从早到晚返回某个玩法的全部开奖结果，不含奖级信息
+func (s *LotteryStore) ListDraws(game string) ([]Draw, error) {
+	rows, err := s.db.Query("select "+drawColumns+" from draws where game=? order by code;", game)
+	if err != nil {
+		return nil, fmt.Errorf("查询开奖结果失败: %w", err)
+	}
+	defer rows.Close()
+
+	var draws []Draw
+	for rows.Next() {
+		d, err := scanDraw(rows)
+		if err != nil {
+			return nil, fmt.Errorf("读取开奖结果失败: %w", err)
+		}
+		draws = append(draws, d)
+	}
+	return draws, rows.Err()
+}
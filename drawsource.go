@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DrawSource 提供开奖结果，返回的结果都按期号从新到旧排列
+// 官网、本地文件都实现这个接口，官网改版时只需要换一个实现；
+// 测试中官网换成按同样协议返回录制数据的替身服务，见 drawsource_test.go
+type DrawSource interface {
+	// Latest 返回最近 n 期
+	Latest(n int) ([]KjggItem, error)
+	// Range 返回期号在 [from, to] 之间的各期，to 为空表示到最新一期
+	Range(from string, to string) ([]KjggItem, error)
+	// DayRange 返回开奖日期在 [dayStart, dayEnd] 之间的各期，日期格式 2006-01-02
+	DayRange(dayStart string, dayEnd string) ([]KjggItem, error)
+}
+
+// cwlGameNames 福彩官网开奖公告接口 name 参数对应的玩法
+var cwlGameNames = map[string]string{
+	"ssq": "ssq",
+	"3d":  "3d",
+	"qlc": "qlc",
+	"kl8": "kl8",
+}
+
+// defaultDrawSources 没有在 -source 中指定时各玩法使用的数据源
+var defaultDrawSources = map[string]string{
+	"ssq": "cwl",
+	"dlt": "sporttery",
+	"3d":  "cwl",
+	"qlc": "cwl",
+	"kl8": "cwl",
+}
+
+// parseDrawSourceSpecs 解析 -source 参数：逗号分隔的 玩法=数据源，不带玩法的数据源用于双色球，
+// 如 "cwl,dlt=file:dlt.csv"，没有指定的玩法使用 defaultDrawSources
+func parseDrawSourceSpecs(value string) (map[string]string, error) {
+	specs := make(map[string]string)
+	for code, spec := range defaultDrawSources {
+		specs[code] = spec
+	}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		code, spec := defaultGameCode, entry
+		if idx := strings.Index(entry, "="); idx >= 0 {
+			code, spec = entry[:idx], entry[idx+1:]
+		}
+		if _, err := gameByCode(code); err != nil {
+			return nil, err
+		}
+		specs[code] = spec
+	}
+	return specs, nil
+}
+
+// newDrawSource 根据 -source 参数为某个玩法创建数据源：
+//
+//	cwl              福彩官网
+//	cwl:<url>        提供官网同样接口的其它地址，如录制好的替身服务
+//	sporttery        体彩官网，目前只有大乐透
+//	sporttery:<url>  提供体彩官网同样接口的其它地址
+//	file:<path>      本地 JSON（接口原始返回或 KjggItem 数组）或 CSV 文件
+func newDrawSource(game Game, spec string, interval time.Duration) (DrawSource, error) {
+	kind, arg := spec, ""
+	if idx := strings.Index(spec, ":"); idx >= 0 {
+		kind, arg = spec[:idx], spec[idx+1:]
+	}
+
+	switch kind {
+	case "cwl":
+		name, ok := cwlGameNames[game.Code()]
+		if !ok {
+			return nil, fmt.Errorf("福彩官网没有%s的开奖公告", game.Name())
+		}
+		if arg == "" {
+			arg = kjggBaseUrl
+		}
+		return newCwlDrawSource(arg, name, interval), nil
+	case "sporttery":
+		gameNo, ok := sportteryGameNos[game.Code()]
+		if !ok {
+			return nil, fmt.Errorf("体彩官网没有%s的开奖公告", game.Name())
+		}
+		if arg == "" {
+			arg = sportteryBaseUrl
+		}
+		return newSportteryDrawSource(arg, gameNo, interval), nil
+	case "file":
+		return newFileDrawSource(game, arg)
+	}
+	return nil, fmt.Errorf("未知的开奖数据源: %s", spec)
+}
+
+// sortKjggItems 按期号从新到旧排序
+func sortKjggItems(items []KjggItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Code > items[j].Code
+	})
+}
+
+// kjggDay 取出公告日期 2022-02-08(二) 中的日期部分
+func kjggDay(item KjggItem) string {
+	if idx := strings.Index(item.Date, "("); idx >= 0 {
+		return item.Date[:idx]
+	}
+	return item.Date
+}
+
+// filterKjggItems 按期号、日期范围筛选，空的边界不做限制
+func filterKjggItems(items []KjggItem, from, to, dayStart, dayEnd string) []KjggItem {
+	var result []KjggItem
+	for _, item := range items {
+		if (from != "" && item.Code < from) || (to != "" && item.Code > to) {
+			continue
+		}
+		day := kjggDay(item)
+		if (dayStart != "" && day < dayStart) || (dayEnd != "" && day > dayEnd) {
+			continue
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// fileDrawSource 从本地文件读取开奖结果，启动时一次性载入
+type fileDrawSource struct {
+	items []KjggItem
+}
+
+func newFileDrawSource(game Game, path string) (*fileDrawSource, error) {
+	items, err := loadKjggItems(game, path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileDrawSource{items: items}, nil
+}
+
+func (f *fileDrawSource) Latest(n int) ([]KjggItem, error) {
+	if n > len(f.items) {
+		n = len(f.items)
+	}
+	return append([]KjggItem(nil), f.items[:n]...), nil
+}
+
+func (f *fileDrawSource) Range(from string, to string) ([]KjggItem, error) {
+	return filterKjggItems(f.items, from, to, "", ""), nil
+}
+
+func (f *fileDrawSource) DayRange(dayStart string, dayEnd string) ([]KjggItem, error) {
+	return filterKjggItems(f.items, "", "", dayStart, dayEnd), nil
+}
+
+// loadKjggItems 读取开奖结果文件，按扩展名区分格式：
+// .csv 每行为 期号,开奖日期,开奖号码依次排列（双色球为 红1,...,红6,蓝，七乐彩最后一个为特别号码）；其它按 JSON 处理，可以是接口原始返回或 KjggItem 数组
+func loadKjggItems(game Game, path string) ([]KjggItem, error) {
+	var items []KjggItem
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		records, err := csv.NewReader(file).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("读取 %s 失败: %w", path, err)
+		}
+		redSize, blueSize := game.DrawSizes()
+		columns := 2 + redSize + blueSize
+		for i, record := range records {
+			if len(record) != columns {
+				return nil, fmt.Errorf("%s 第%d行应有%d列，实际%d列", path, i+1, columns, len(record))
+			}
+			first := 2 + redSize
+			items = append(items, KjggItem{
+				Name: game.Name(),
+				Code: strings.TrimSpace(record[0]),
+				Date: strings.TrimSpace(record[1]),
+				Red:  strings.Join(record[2:first], ","),
+				Blue: strings.Join(record[first:], ","),
+			})
+		}
+	} else {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var data KjggData
+		if err = json.Unmarshal(content, &data); err == nil {
+			items = data.Result
+		} else if err = json.Unmarshal(content, &items); err != nil {
+			return nil, fmt.Errorf("解析 %s 失败: %w", path, err)
+		}
+	}
+	sortKjggItems(items)
+	return items, nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeCwlServer 按官网 findDrawNotice 协议返回录制数据的替身服务，
+// 支持 issueCount、issueStart/issueEnd、dayStart/dayEnd 以及 pageNo/pageSize 分页
+type fakeCwlServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []url.Values                // 收到的每个请求的参数
+	fail     func(query url.Values) bool // 返回 true 时该请求返回 500，模拟官网出错
+}
+
+// newFakeCwlServer 启动替身服务，测试结束时关闭
+func newFakeCwlServer(t *testing.T, items []KjggItem) *fakeCwlServer {
+	sorted := append([]KjggItem(nil), items...)
+	sortKjggItems(sorted)
+
+	fake := &fakeCwlServer{}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		fake.mu.Lock()
+		fake.requests = append(fake.requests, query)
+		fail := fake.fail != nil && fake.fail(query)
+		fake.mu.Unlock()
+		if fail {
+			http.Error(w, "服务繁忙", http.StatusInternalServerError)
+			return
+		}
+
+		result := filterKjggItems(sorted, query.Get("issueStart"), query.Get("issueEnd"), query.Get("dayStart"), query.Get("dayEnd"))
+		if n, err := strconv.Atoi(query.Get("issueCount")); err == nil && n < len(result) {
+			result = result[:n]
+		}
+
+		data := KjggData{State: 0, Message: "查询成功", CountNum: len(result), PageCount: 1, Result: result}
+		if pageSize, err := strconv.Atoi(query.Get("pageSize")); err == nil && pageSize > 0 {
+			pageNo, err := strconv.Atoi(query.Get("pageNo"))
+			if err != nil || pageNo < 1 {
+				pageNo = 1
+			}
+			data.PageCount = int(math.Ceil(float64(len(result)) / float64(pageSize)))
+			start := (pageNo - 1) * pageSize
+			end := start + pageSize
+			if start > len(result) {
+				start = len(result)
+			}
+			if end > len(result) {
+				end = len(result)
+			}
+			data.Result = result[start:end]
+		}
+
+		bts, err := json.Marshal(data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(bts)
+	}))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// requestCount 收到的请求数
+func (f *fakeCwlServer) requestCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.requests)
+}
+
+// newTestStore 在临时目录中创建数据库并执行全部迁移，测试结束时删除
+func newTestStore(t *testing.T) *LotteryStore {
+	store := openTestStore(t)
+	if _, err := store.Migrate(false); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// openTestStore 在临时目录中创建空数据库，不执行迁移，测试结束时删除
+func openTestStore(t *testing.T) *LotteryStore {
+	dir, err := ioutil.TempDir("", "lottery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenLotteryStore(filepath.Join(dir, "test.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		store.Close()
+		os.RemoveAll(dir)
+	})
+	return store
+}
+
+// loadFixture 读取 testdata 中录制的开奖公告
+func loadFixture(t *testing.T, game Game, name string) []KjggItem {
+	items, err := loadKjggItems(game, filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+// insertTestTicket 保存一注参与 issueCode 期的号码
+func insertTestTicket(t *testing.T, store *LotteryStore, game Game, issueCode string, numbers string) int64 {
+	ticket, err := game.ParseTicket("", numbers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := store.InsertLottery(game.Code(), issueCode, TicketRecord{
+		Ticket:   ticket,
+		Numbers:  numbers,
+		Bets:     len(expandTicket(game, ticket)),
+		Strategy: "random",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// ticketResult 读取计奖结果，没有时 ok 为 false
+func ticketResult(store *LotteryStore, id int64) (grade int, money int64, ok bool) {
+	err := store.db.QueryRow("select prize_grade, prize_money from ticket_results where ticket_id=?;", id).Scan(&grade, &money)
+	if err != nil {
+		return 0, 0, false
+	}
+	return grade, money, true
+}
+
+func countRows(t *testing.T, store *LotteryStore, query string, args ...interface{}) int {
+	var n int
+	if err := store.db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestQueryGameKjggIngestsAndGrades(t *testing.T) {
+	game, _ := gameByCode("ssq")
+	store := newTestStore(t)
+	fake := newFakeCwlServer(t, loadFixture(t, game, "ssq_kjgg.json"))
+	s := &server{
+		store:   store,
+		sources: map[string]DrawSource{"ssq": newCwlDrawSource(fake.URL, "ssq", 0)},
+		models:  newModelCache(),
+	}
+	if err := s.models.Load(store, game); err != nil {
+		t.Fatal(err)
+	}
+
+	//2022015 期开奖号码为 04 11 13 21 25 32 + 07，一等奖单注 6512835 元
+	first := insertTestTicket(t, store, game, "2022015", "04 11 13 21 25 32 07")
+	third := insertTestTicket(t, store, game, "2022015", "04 11 13 21 25 33 07")
+	none := insertTestTicket(t, store, game, "2022015", "01 02 03 05 06 08 01")
+	compound := insertTestTicket(t, store, game, "2022015", "04 11 13 21 25 32 33+07")
+	later := insertTestTicket(t, store, game, "2022016", "04 11 13 21 25 32 07")
+
+	s.queryGameKjgg(game)
+
+	draws, err := store.ListDraws("ssq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(draws) != 5 || draws[0].Code != "2022011" || draws[4].Code != "2022015" {
+		t.Fatalf("入库的开奖结果不对: %+v", draws)
+	}
+	if draws[4].DrawDate != "2022-02-10" || draws[4].Red != "04,11,13,21,25,32" || draws[4].Blue != "07" {
+		t.Fatalf("2022015 期开奖结果不对: %+v", draws[4])
+	}
+	if status := s.models.Status(); status[0].TrainingSize != 5 || status[0].LastIssue != "2022015" {
+		t.Fatalf("模型没有更新: %+v", status)
+	}
+
+	cases := []struct {
+		name  string
+		id    int64
+		grade int
+		money int64
+	}{
+		{"一等奖", first, 1, 651283500},
+		{"三等奖", third, 3, 300000},
+		{"未中奖", none, noPrize, 0},
+		//7+1 复式展开为 7 注：1 注 6+1，6 注 5+1
+		{"复式", compound, 1, 651283500 + 6*300000},
+	}
+	for _, c := range cases {
+		grade, money, ok := ticketResult(store, c.id)
+		if !ok || grade != c.grade || money != c.money {
+			t.Errorf("%s: 奖级 %d 奖金 %d（已计奖 %v），应为奖级 %d 奖金 %d", c.name, grade, money, ok, c.grade, c.money)
+		}
+	}
+	if _, _, ok := ticketResult(store, later); ok {
+		t.Errorf("2022016 期还没有开奖，不应计奖")
+	}
+	if n := countRows(t, store, "select count(*) from ticket_result_tiers where ticket_id=?;", compound); n != 2 {
+		t.Errorf("复式号码应有 2 个奖级的明细，实际 %d 个", n)
+	}
+}
+
+func TestQueryGameKjggIsIdempotent(t *testing.T) {
+	game, _ := gameByCode("ssq")
+	store := newTestStore(t)
+	fake := newFakeCwlServer(t, loadFixture(t, game, "ssq_kjgg.json"))
+	s := &server{
+		store:   store,
+		sources: map[string]DrawSource{"ssq": newCwlDrawSource(fake.URL, "ssq", 0)},
+		models:  newModelCache(),
+	}
+	id := insertTestTicket(t, store, game, "2022015", "04 11 13 21 25 33 07")
+
+	s.queryGameKjgg(game)
+	s.queryGameKjgg(game)
+
+	if n := countRows(t, store, "select count(*) from draws where game='ssq';"); n != 5 {
+		t.Errorf("重复查询后开奖结果应仍为 5 期，实际 %d 期", n)
+	}
+	if n := countRows(t, store, "select count(*) from ticket_results where ticket_id=?;", id); n != 1 {
+		t.Errorf("重复查询后计奖结果应仍为 1 条，实际 %d 条", n)
+	}
+	if status := s.models.Status(); status[0].TrainingSize != 5 {
+		t.Errorf("重复查询后模型应仍为 5 期，实际 %d 期", status[0].TrainingSize)
+	}
+	if fake.requestCount() != 2 {
+		t.Errorf("每次查询应只请求一次开奖公告，实际 %d 次", fake.requestCount())
+	}
+}
+
+func TestQueryGameKjggKeepsMalformedTicketPending(t *testing.T) {
+	game, _ := gameByCode("ssq")
+	store := newTestStore(t)
+	fake := newFakeCwlServer(t, loadFixture(t, game, "ssq_kjgg.json"))
+	s := &server{
+		store:   store,
+		sources: map[string]DrawSource{"ssq": newCwlDrawSource(fake.URL, "ssq", 0)},
+		models:  newModelCache(),
+	}
+	good := insertTestTicket(t, store, game, "2022015", "04 11 13 21 25 33 07")
+	bad := insertTestTicket(t, store, game, "2022015", "04 11 13 21 25 32 07")
+	if _, err := store.db.Exec("update tickets set drags='04,xx' where id=?;", bad); err != nil {
+		t.Fatal(err)
+	}
+
+	s.queryGameKjgg(game)
+
+	if _, _, ok := ticketResult(store, good); !ok {
+		t.Error("格式正确的号码应已计奖")
+	}
+	if _, _, ok := ticketResult(store, bad); ok {
+		t.Error("格式错误的号码不应记为已计奖")
+	}
+	pending, err := store.PendingTickets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || int64(pending[0].TicketId) != bad {
+		t.Errorf("格式错误的号码应保持待计奖: %+v", pending)
+	}
+}
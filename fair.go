@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxClientSeedLength 客户端种子的最大长度
+const maxClientSeedLength = 64
+
+// 可验证公平的生成方式（commit-reveal）：
+// 每个玩法的每一期有一个服务端种子，开售时只公布它的 SHA-256 作为承诺；
+// 客户端带 clientSeed 参数生成号码时，号码的种子为 HMAC-SHA256(服务端种子, clientSeed:nonce) 的前 8 个字节，
+// nonce 为该服务端种子已生成过的种子个数；开奖后公布服务端种子，/verify 重新计算并复现号码，
+// 证明号码在开奖前就已确定
+
+// ServerSeed 某个玩法某一期的服务端种子
+type ServerSeed struct {
+	Game       string
+	IssueCode  string
+	Seed       string // 32 字节随机数的十六进制
+	Commitment string // Seed 的 SHA-256 的十六进制
+}
+
+// commitSeed 服务端种子的承诺
+func commitSeed(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+// fairSeed 由服务端种子、客户端种子和 nonce 计算号码的种子
+func fairSeed(serverSeed string, clientSeed string, nonce int64) int64 {
+	mac := hmac.New(sha256.New, []byte(serverSeed))
+	mac.Write([]byte(clientSeed + ":" + strconv.FormatInt(nonce, 10)))
+	return int64(binary.BigEndian.Uint64(mac.Sum(nil)[:8]))
+}
+
+func newServerSeed() (string, error) {
+	var buf [32]byte
+	if _, err := crand.Read(buf[:]); err != nil {
+		return "", fmt.Errorf("读取随机数失败: %w", err)
+	}
+	return hex.EncodeToString(buf[:]), nil
+}
+
+// ServerSeed 返回某个玩法某一期的服务端种子，不存在时生成
+func (s *LotteryStore) ServerSeed(game string, issueCode string) (ServerSeed, error) {
+	seed, err := newServerSeed()
+	if err != nil {
+		return ServerSeed{}, err
+	}
+	_, err = s.db.Exec("insert or ignore into server_seeds (game, issue_code, seed, commitment) values (?, ?, ?, ?);",
+		game, issueCode, seed, commitSeed(seed))
+	if err != nil {
+		return ServerSeed{}, fmt.Errorf("保存服务端种子失败: %w", err)
+	}
+	result := ServerSeed{Game: game, IssueCode: issueCode}
+	err = s.db.QueryRow("select seed, commitment from server_seeds where game=? and issue_code=?;", game, issueCode).
+		Scan(&result.Seed, &result.Commitment)
+	if err != nil {
+		return ServerSeed{}, fmt.Errorf("查询服务端种子失败: %w", err)
+	}
+	return result, nil
+}
+
+// NextNonce 返回某个玩法某一期的服务端种子和下一个 nonce，服务端种子不存在时生成
+// 用一条 update ... returning 取号并加一，并发生成时不会拿到相同的 nonce
+func (s *LotteryStore) NextNonce(game string, issueCode string) (ServerSeed, int64, error) {
+	seed, err := s.ServerSeed(game, issueCode)
+	if err != nil {
+		return ServerSeed{}, 0, err
+	}
+	var nonce int64
+	err = s.db.QueryRow("update server_seeds set nonce=nonce+1 where game=? and issue_code=? returning nonce-1;", game, issueCode).Scan(&nonce)
+	if err != nil {
+		return ServerSeed{}, 0, fmt.Errorf("更新 nonce 失败: %w", err)
+	}
+	return seed, nonce, nil
+}
+
+// SkippedNonce 批量生成时取了 nonce 但没有保存的号码，和保存的号码一起覆盖全部 nonce，
+// 开奖后可以用公布的服务端种子逐个复现，证明中间没有藏起来的号码
+type SkippedNonce struct {
+	Nonce   int64  `json:"nonce"`
+	Numbers string `json:"numbers"`
+	Reason  string `json:"reason"`
+}
+
+// SaveSkippedNonces 保存某个玩法某一期被跳过的 nonce
+func (s *LotteryStore) SaveSkippedNonces(game string, issueCode string, clientSeed string, skipped []SkippedNonce) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+	for _, item := range skipped {
+		_, err = tx.Exec("insert into skipped_nonces (game, issue_code, nonce, client_seed, numbers, reason) values (?, ?, ?, ?, ?, ?);",
+			game, issueCode, item.Nonce, clientSeed, item.Numbers, item.Reason)
+		if err != nil {
+			return fmt.Errorf("保存跳过的 nonce 失败: %w", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("提交跳过的 nonce 失败: %w", err)
+	}
+	return nil
+}
+
+// fairRandom 客户端带 clientSeed 参数时的随机数来源，种子由服务端种子和客户端种子计算
+type fairRandom struct {
+	store      *LotteryStore
+	game       string
+	issueCode  string
+	clientSeed string
+}
+
+func (f *fairRandom) Seed() (Provenance, error) {
+	serverSeed, nonce, err := f.store.NextNonce(f.game, f.issueCode)
+	if err != nil {
+		return Provenance{}, err
+	}
+	return Provenance{
+		Seed:       fairSeed(serverSeed.Seed, f.clientSeed, nonce),
+		Entropy:    "hmac",
+		ClientSeed: f.clientSeed,
+		Nonce:      nonce,
+		Commitment: serverSeed.Commitment,
+	}, nil
+}
+
+// requestRandom 请求带 clientSeed 参数时使用 issueCode 期服务端种子的可验证公平的随机数来源，否则使用服务启动时指定的来源
+func (s *server) requestRandom(game Game, r *http.Request, issueCode string) (RandomSource, error) {
+	clientSeed := r.Form.Get("clientSeed")
+	if clientSeed == "" {
+		return s.random, nil
+	}
+	if len(clientSeed) > maxClientSeedLength {
+		return nil, fmt.Errorf("clientSeed 不能超过%d个字符", maxClientSeedLength)
+	}
+	return &fairRandom{store: s.store, game: game.Code(), issueCode: issueCode, clientSeed: clientSeed}, nil
+}
+
+// Commitment 公布的服务端种子承诺
+type Commitment struct {
+	Game       string `json:"game"`
+	IssueCode  string `json:"issueCode"`
+	Commitment string `json:"commitment"`
+}
+
+// commitmentFunc 返回当前可以生成号码的一期服务端种子的承诺，生成号码前先记下它，开奖后用 /verify 核对
+func (s *server) commitmentFunc(w http.ResponseWriter, r *http.Request) {
+	game, err := requestGame(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	issueCode, err := s.store.targetIssueCode(game, time.Now())
+	if err != nil {
+		fmt.Println("计算期号失败:", err)
+		http.Error(w, "计算期号失败", http.StatusInternalServerError)
+		return
+	}
+	seed, err := s.store.ServerSeed(game.Code(), issueCode)
+	if err != nil {
+		fmt.Println("查询服务端种子失败:", err)
+		http.Error(w, "查询服务端种子失败", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, Commitment{Game: seed.Game, IssueCode: seed.IssueCode, Commitment: seed.Commitment})
+}
+
+// Verification 一注号码的验证结果
+type Verification struct {
+	Id         int64  `json:"id"`
+	Game       string `json:"game"`
+	IssueCode  string `json:"issueCode"`
+	Numbers    string `json:"numbers"`
+	Commitment string `json:"commitment"` // 生成号码时记录的承诺
+	ServerSeed string `json:"serverSeed"`
+	ClientSeed string `json:"clientSeed"`
+	Nonce      int64  `json:"nonce"`
+	Seed       string `json:"seed"`       // 号码的种子，十进制，避免 JS 丢失精度
+	Reproduced string `json:"reproduced"` // 重新生成的号码
+	Valid      bool   `json:"valid"`      // 公布的服务端种子和生成时的承诺一致，且复现的号码一致
+}
+
+// verifyFunc 开奖后公布服务端种子，按 HMAC 重新计算种子并复现号码；开奖前只返回 403
+func (s *server) verifyFunc(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	id, err := strconv.ParseInt(r.Form.Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "id参数错误", http.StatusBadRequest)
+		return
+	}
+	stored, err := s.store.GetTicket(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "号码不存在", http.StatusNotFound)
+		return
+	} else if err != nil {
+		fmt.Println("查询号码失败:", err)
+		http.Error(w, "查询号码失败", http.StatusInternalServerError)
+		return
+	}
+	if stored.Provenance.Entropy != "hmac" {
+		http.Error(w, "该号码不是带 clientSeed 生成的，无法验证", http.StatusBadRequest)
+		return
+	}
+
+	//开奖结果入库前不公布服务端种子
+	if _, err = s.store.GetDraw(stored.Game, stored.IssueCode); err == sql.ErrNoRows {
+		http.Error(w, fmt.Sprintf("第%s期开奖后才公布服务端种子", stored.IssueCode), http.StatusForbidden)
+		return
+	} else if err != nil {
+		fmt.Println("查询开奖结果失败:", err)
+		http.Error(w, "查询开奖结果失败", http.StatusInternalServerError)
+		return
+	}
+	seed, err := s.store.ServerSeed(stored.Game, stored.IssueCode)
+	if err != nil {
+		fmt.Println("查询服务端种子失败:", err)
+		http.Error(w, "查询服务端种子失败", http.StatusInternalServerError)
+		return
+	}
+
+	p := stored.Provenance
+	result := Verification{Id: stored.Id, Game: stored.Game, IssueCode: stored.IssueCode, Numbers: stored.Numbers,
+		Commitment: p.Commitment, ServerSeed: seed.Seed, ClientSeed: p.ClientSeed, Nonce: p.Nonce}
+	computed := fairSeed(seed.Seed, p.ClientSeed, p.Nonce)
+	result.Seed = strconv.FormatInt(computed, 10)
+
+	//按重新计算的种子复现，不使用保存的种子
+	p.Seed = computed
+	stored.Provenance = p
+	if result.Reproduced, err = reproduceTicket(s.store, stored); err != nil {
+		fmt.Println("复现号码失败:", err)
+		http.Error(w, "复现号码失败", http.StatusInternalServerError)
+		return
+	}
+	//和生成号码时记下的承诺核对，而不是 server_seeds 中同一行的承诺，服务端事后换了种子也能发现
+	result.Valid = commitSeed(seed.Seed) == p.Commitment && result.Reproduced == stored.Numbers
+	writeJSON(w, result)
+}
+
+// writeJSON 以 JSON 返回 v
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	bts, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "序列化结果失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bts)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestNextNonceConcurrent(t *testing.T) {
+	store := newTestStore(t)
+	const workers, each = 8, 25
+
+	var mu sync.Mutex
+	seen := map[int64]bool{}
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				_, nonce, err := store.NextNonce("ssq", "2022015")
+				if err != nil {
+					errs <- err
+					return
+				}
+				mu.Lock()
+				seen[nonce] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if len(seen) != workers*each {
+		t.Errorf("并发取 %d 个 nonce，不重复的只有 %d 个", workers*each, len(seen))
+	}
+	for nonce := int64(0); nonce < workers*each; nonce++ {
+		if !seen[nonce] {
+			t.Errorf("缺少 nonce %d", nonce)
+		}
+	}
+}
+
+// verifyTicket 调用 /verify 验证一注号码
+func verifyTicket(t *testing.T, s *server, id int64) Verification {
+	w := httptest.NewRecorder()
+	s.verifyFunc(w, httptest.NewRequest("GET", "/verify?id="+strconv.FormatInt(id, 10), nil))
+	if w.Code != 200 {
+		t.Fatalf("验证失败: %d %s", w.Code, w.Body.String())
+	}
+	var result Verification
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestVerifyChecksCommitmentRecordedAtGeneration(t *testing.T) {
+	game, _ := gameByCode("ssq")
+	store := newTestStore(t)
+	if _, err := saveKjggItems(store, game, loadFixture(t, game, "ssq_kjgg.json")); err != nil {
+		t.Fatal(err)
+	}
+	s := &server{store: store, models: newModelCache()}
+	if err := s.models.Load(store, game); err != nil {
+		t.Fatal(err)
+	}
+
+	random := &fairRandom{store: store, game: "ssq", issueCode: "2022015", clientSeed: "abc"}
+	req := TicketRequest{Strategy: "markov", Params: markovGenerator{}.Params()}
+	ticket, provenance, err := s.generateTicket(game, req, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := store.InsertLottery("ssq", "2022015", newTicketRecord(game, req, ticket, provenance))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := verifyTicket(t, s, id)
+	if !result.Valid || result.Reproduced != result.Numbers || result.Commitment != commitSeed(result.ServerSeed) {
+		t.Fatalf("未改动的号码应验证通过: %+v", result)
+	}
+
+	//服务端事后换了种子和承诺，和生成时记下的承诺对不上
+	seed, _ := newServerSeed()
+	if _, err = store.db.Exec("update server_seeds set seed=?, commitment=? where game='ssq' and issue_code='2022015';", seed, commitSeed(seed)); err != nil {
+		t.Fatal(err)
+	}
+	if result = verifyTicket(t, s, id); result.Valid {
+		t.Errorf("换了服务端种子后不应验证通过: %+v", result)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// fc3dGame 福彩3D：百位、十位、个位各开出一个 0-9 的数字，号码可以重复
+// 直选按位置投注；组三投注两个相同、一个不同的数字，组六投注三个不同的数字，都不限顺序
+type fc3dGame struct {
+	zoneGame
+}
+
+func newFc3dGame() *fc3dGame {
+	return &fc3dGame{zoneGame{
+		code: "3d",
+		name: "福彩3D",
+		zones: []Zone{
+			{Name: "百位", Pick: 1, Min: 0, Max: 9},
+			{Name: "十位", Pick: 1, Min: 0, Max: 9},
+			{Name: "个位", Pick: 1, Min: 0, Max: 9},
+		},
+		calendar:   newDrawCalendar(everyDay, 21, 15, 20, 0),
+		firstIssue: "2004001",
+		plays: []Play{
+			{Code: "zx", Name: "直选"},
+			{Code: "z3", Name: "组三"},
+			{Code: "z6", Name: "组六"},
+		},
+		ruleSets: fc3dRuleSets,
+	}}
+}
+
+// digits 取出三个位置上的数字
+func (g *fc3dGame) digits(ticket Ticket) []int {
+	var digits []int
+	for _, zone := range ticket.Zones {
+		digits = append(digits, zone...)
+	}
+	return digits
+}
+
+// ParseTicket 组三、组六的号码统一按升序保存
+func (g *fc3dGame) ParseTicket(play string, numbers string) (Ticket, error) {
+	ticket, err := g.zoneGame.ParseTicket(play, numbers)
+	if err != nil {
+		return ticket, err
+	}
+	if play == "zx" {
+		return ticket, nil
+	}
+
+	digits := g.digits(ticket)
+	distinct := len(countDigits(digits))
+	if play == "z3" && distinct != 2 {
+		return ticket, fmt.Errorf("组三号码 %q 应为两个相同、一个不同的数字", numbers)
+	}
+	if play == "z6" && distinct != 3 {
+		return ticket, fmt.Errorf("组六号码 %q 应为三个不同的数字", numbers)
+	}
+	sort.Ints(digits)
+	return digitsTicket(play, digits), nil
+}
+
+// Generate 直选按每个位置的历史频率生成；组六从三个位置合并的频率中选三个不同的数字，
+// 组三再从中选一个数字重复两次
+func (g *fc3dGame) Generate(model *Model, req TicketRequest, r *rand.Rand) (Ticket, error) {
+	play := req.Play
+	if play == "zx" {
+		var digits []int
+		for i, zone := range g.zones {
+			digits = append(digits, generateBlueNumbers(model.frequency(i), zone, nil, nil, r)...)
+		}
+		return digitsTicket(play, digits), nil
+	}
+
+	probs := make(map[int]float64)
+	for i := range g.zones {
+		for digit, count := range model.frequency(i) {
+			probs[digit] += count
+		}
+	}
+	digitZone := Zone{Name: "号码", Min: 0, Max: 9}
+	var digits []int
+	switch play {
+	case "z3":
+		digitZone.Pick = 2
+		digits = generateBlueNumbers(probs, digitZone, nil, nil, r)
+		digits = append(digits, digits[0])
+	case "z6":
+		digitZone.Pick = 3
+		digits = generateBlueNumbers(probs, digitZone, nil, nil, r)
+	default:
+		return Ticket{}, fmt.Errorf("福彩3D不支持投注方式: %s", play)
+	}
+	sort.Ints(digits)
+	return digitsTicket(play, digits), nil
+}
+
+func (g *fc3dGame) DrawSizes() (int, int) {
+	return len(g.zones), 0
+}
+
+// DrawNumbers 开奖的三个数字按位置保存在 red
+func (g *fc3dGame) DrawNumbers(draw Draw) (Ticket, error) {
+	digits, err := parseNumbers(draw.Red, ",")
+	if err != nil {
+		return Ticket{}, err
+	}
+	if len(digits) != len(g.zones) {
+		return Ticket{}, fmt.Errorf("第%s期福彩3D开奖号码格式错误: %s", draw.Code, draw.Red)
+	}
+	return digitsTicket("", digits), nil
+}
+
+func (g *fc3dGame) FormatTicket(ticket Ticket) string {
+	return formatNumbers(g.digits(ticket), " ")
+}
+
+// Grade 直选返回每个位置是否相同，组三、组六返回不计顺序相同的数字个数
+func (g *fc3dGame) Grade(ticket Ticket, drawn Ticket, rules *RuleSet) ([]int, int) {
+	mine, result := g.digits(ticket), g.digits(drawn)
+	var hits []int
+	if ticket.Play == "zx" {
+		hits = make([]int, len(g.zones))
+		for i := range hits {
+			if i < len(mine) && i < len(result) && mine[i] == result[i] {
+				hits[i] = 1
+			}
+		}
+	} else {
+		drawnCounts := countDigits(result)
+		same := 0
+		for digit, n := range countDigits(mine) {
+			if drawnCounts[digit] < n {
+				n = drawnCounts[digit]
+			}
+			same += n
+		}
+		hits = []int{same}
+	}
+
+	if tier := rules.Grade(ticket.Play, hits...); tier != nil {
+		return hits, tier.Grade
+	}
+	return hits, noPrize
+}
+
+// countDigits 统计每个数字出现的次数
+func countDigits(digits []int) map[int]int {
+	counts := make(map[int]int)
+	for _, d := range digits {
+		counts[d]++
+	}
+	return counts
+}
+
+// digitsTicket 三个数字依次放入百位、十位、个位
+func digitsTicket(play string, digits []int) Ticket {
+	ticket := Ticket{Play: play}
+	for _, d := range digits {
+		ticket.Zones = append(ticket.Zones, []int{d})
+	}
+	return ticket
+}
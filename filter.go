@@ -0,0 +1,378 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxFilterAttempts 按过滤条件生成号码时最多重新生成的次数
+const maxFilterAttempts = 10000
+
+// Range 闭区间，如和值 80-120
+type Range struct {
+	Min int
+	Max int
+}
+
+// Filter 生成号码的过滤条件，作用于第一个区（双色球红球、大乐透前区、快乐8所选号码，福彩3D 为三个数字），零值表示不过滤。
+// 包含、排除的号码在生成第一个区时直接使用（福彩3D 除外），其余条件不满足时重新生成，见 generateFiltered
+type Filter struct {
+	Sum       *Range // 和值
+	OddEven   []int  // 奇偶比，如 {4, 2} 为 4 个奇数、2 个偶数
+	Include   []int  // 必须包含的号码
+	Exclude   []int  // 不能包含的号码
+	MaxRun    int    // 最多几个号码相连，如 2 允许 05 06、不允许 05 06 07；0 不限
+	Span      *Range // 跨度，最大号码减最小号码
+	Repeat    *Range // 和上一期开奖号码相同的个数
+	ZoneRatio []int  // 三区比，号码范围平均分为三段后每段的个数，如双色球 01-11、12-22、23-33 各 2 个为 {2, 2, 2}
+}
+
+// parseFilter 读取过滤条件，请求参数和 tickets.request 中的名称相同：
+// sum=80-120、oddEven=4:2、include=01 05、exclude=07,08、maxRun=2、span=20-30、repeat=0-1、zoneRatio=2:2:2
+func parseFilter(values url.Values) (Filter, error) {
+	var f Filter
+	var err error
+	if f.Sum, err = parseRange("和值", values.Get("sum")); err != nil {
+		return Filter{}, err
+	}
+	if f.OddEven, err = parseRatio("奇偶比", values.Get("oddEven"), 2); err != nil {
+		return Filter{}, err
+	}
+	if f.Include, err = parseNumbers(strings.ReplaceAll(values.Get("include"), " ", ","), ","); err != nil {
+		return Filter{}, fmt.Errorf("包含的号码%w", err)
+	}
+	if f.Exclude, err = parseNumbers(strings.ReplaceAll(values.Get("exclude"), " ", ","), ","); err != nil {
+		return Filter{}, fmt.Errorf("排除的号码%w", err)
+	}
+	if value := values.Get("maxRun"); value != "" {
+		if f.MaxRun, err = strconv.Atoi(value); err != nil || f.MaxRun < 0 {
+			return Filter{}, fmt.Errorf("连号个数 %q 应为非负整数", value)
+		}
+	}
+	if f.Span, err = parseRange("跨度", values.Get("span")); err != nil {
+		return Filter{}, err
+	}
+	if f.Repeat, err = parseRange("重号个数", values.Get("repeat")); err != nil {
+		return Filter{}, err
+	}
+	if f.ZoneRatio, err = parseRatio("三区比", values.Get("zoneRatio"), 3); err != nil {
+		return Filter{}, err
+	}
+	return f, nil
+}
+
+// parseRange 解析 80-120 或 100 这样的范围，空串为不限
+func parseRange(name string, value string) (*Range, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parts := strings.SplitN(value, "-", 2)
+	if len(parts) == 1 {
+		parts = append(parts, parts[0])
+	}
+	min, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+	max, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err1 != nil || err2 != nil || min < 0 || min > max {
+		return nil, fmt.Errorf("%s %q 格式错误，应为 最小值-最大值", name, value)
+	}
+	return &Range{Min: min, Max: max}, nil
+}
+
+// parseRatio 解析 4:2 这样的 n 个非负整数，空串为不限
+func parseRatio(name string, value string, n int) ([]int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) != n {
+		return nil, fmt.Errorf("%s %q 应为%d个以冒号分隔的数", name, value, n)
+	}
+	ratio := make([]int, n)
+	for i, part := range parts {
+		count, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("%s %q 格式错误", name, value)
+		}
+		ratio[i] = count
+	}
+	return ratio, nil
+}
+
+func formatRange(r *Range) string {
+	if r.Min == r.Max {
+		return strconv.Itoa(r.Min)
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+func formatRatio(ratio []int) string {
+	parts := make([]string, len(ratio))
+	for i, count := range ratio {
+		parts[i] = strconv.Itoa(count)
+	}
+	return strings.Join(parts, ":")
+}
+
+// encode 把过滤条件加入 values，格式和 parseFilter 读取的相同
+func (f Filter) encode(values url.Values) {
+	if f.Sum != nil {
+		values.Set("sum", formatRange(f.Sum))
+	}
+	if len(f.OddEven) > 0 {
+		values.Set("oddEven", formatRatio(f.OddEven))
+	}
+	if len(f.Include) > 0 {
+		values.Set("include", formatNumbers(f.Include, ","))
+	}
+	if len(f.Exclude) > 0 {
+		values.Set("exclude", formatNumbers(f.Exclude, ","))
+	}
+	if f.MaxRun > 0 {
+		values.Set("maxRun", strconv.Itoa(f.MaxRun))
+	}
+	if f.Span != nil {
+		values.Set("span", formatRange(f.Span))
+	}
+	if f.Repeat != nil {
+		values.Set("repeat", formatRange(f.Repeat))
+	}
+	if len(f.ZoneRatio) > 0 {
+		values.Set("zoneRatio", formatRatio(f.ZoneRatio))
+	}
+}
+
+func (f Filter) empty() bool {
+	return f.Sum == nil && len(f.OddEven) == 0 && len(f.Include) == 0 && len(f.Exclude) == 0 &&
+		f.MaxRun == 0 && f.Span == nil && f.Repeat == nil && len(f.ZoneRatio) == 0
+}
+
+// filterZone 过滤条件作用的号码范围及每注的个数；distinct 为 false 时号码可以重复，如福彩3D 的三个数字
+func filterZone(game Game, play string) (zone Zone, distinct bool) {
+	zones := game.ZonesFor(play)
+	if _, ok := game.(digitGame); ok {
+		return Zone{Name: "号码", Min: 0, Max: 9, Pick: len(zones)}, false
+	}
+	return zones[0], true
+}
+
+// filterNumbers 一注号码（或一期开奖号码）中过滤条件作用的号码
+func filterNumbers(game Game, ticket Ticket) []int {
+	if g, ok := game.(digitGame); ok {
+		return g.digits(ticket)
+	}
+	if len(ticket.Zones) == 0 {
+		return nil
+	}
+	return ticket.Zones[0]
+}
+
+// zoneArea 号码 n 在三区比中属于第几段，从 0 开始
+func zoneArea(zone Zone, n int) int {
+	width := (zone.Max - zone.Min + 3) / 3
+	return (n - zone.Min) / width
+}
+
+// fixedNumbers 第一个区事先定好的号码：胆码、指定的拖码以及过滤条件要求包含的号码；
+// 福彩3D 包含的数字可以在任意位置，第一个区（百位）只有一个数字，不放入，生成后由 generateFiltered 检查
+func fixedNumbers(game Game, req TicketRequest) []int {
+	fixed := append(append([]int(nil), req.Bankers...), req.Drags...)
+	if _, ok := game.(digitGame); !ok {
+		fixed = append(fixed, req.Filter.Include...)
+	}
+	return fixed
+}
+
+// check 检查过滤条件本身能否满足，如和值超出可能的范围、三区比之和不等于每注的个数；
+// 几个条件合起来无法满足的，生成时多次重新生成后报错
+func (f Filter) check(game Game, req TicketRequest) error {
+	if f.empty() {
+		return nil
+	}
+	if len(req.Sizes) > 0 || len(req.Bankers) > 0 {
+		return fmt.Errorf("%s过滤条件只支持单式号码", game.Name())
+	}
+	zone, distinct := filterZone(game, req.Play)
+	size := zone.Max - zone.Min + 1
+
+	excluded := make(map[int]bool)
+	for _, n := range f.Exclude {
+		if n < zone.Min || n > zone.Max {
+			return fmt.Errorf("%s排除的号码 %02d 不在 %02d-%02d 之间", game.Name(), n, zone.Min, zone.Max)
+		}
+		excluded[n] = true
+	}
+	included := make(map[int]bool)
+	for _, n := range f.Include {
+		if n < zone.Min || n > zone.Max {
+			return fmt.Errorf("%s包含的号码 %02d 不在 %02d-%02d 之间", game.Name(), n, zone.Min, zone.Max)
+		}
+		if excluded[n] {
+			return fmt.Errorf("%s号码 %02d 不能既包含又排除", game.Name(), n)
+		}
+		if included[n] {
+			return fmt.Errorf("%s包含的号码 %02d 重复", game.Name(), n)
+		}
+		included[n] = true
+	}
+	if len(f.Include) > zone.Pick {
+		return fmt.Errorf("%s包含的号码有%d个，多于每注的%d个", game.Name(), len(f.Include), zone.Pick)
+	}
+	if len(excluded) == size || distinct && size-len(excluded) < zone.Pick {
+		return fmt.Errorf("%s排除%d个号码后剩余的号码不足%d个", game.Name(), len(excluded), zone.Pick)
+	}
+
+	//号码不重复时最小的和值为最小的 Pick 个号码之和，可以重复时为 Min*Pick
+	lowest, highest := zone.Min*zone.Pick, zone.Max*zone.Pick
+	minSpan := 0
+	if distinct {
+		lowest = (zone.Min + zone.Min + zone.Pick - 1) * zone.Pick / 2
+		highest = (zone.Max + zone.Max - zone.Pick + 1) * zone.Pick / 2
+		minSpan = zone.Pick - 1
+	}
+	if f.Sum != nil && (f.Sum.Max < lowest || f.Sum.Min > highest) {
+		return fmt.Errorf("%s和值应在%d到%d之间", game.Name(), lowest, highest)
+	}
+	if f.Span != nil && (f.Span.Max < minSpan || f.Span.Min > size-1) {
+		return fmt.Errorf("%s跨度应在%d到%d之间", game.Name(), minSpan, size-1)
+	}
+
+	if len(f.OddEven) > 0 {
+		if f.OddEven[0]+f.OddEven[1] != zone.Pick {
+			return fmt.Errorf("%s奇偶比之和应为%d", game.Name(), zone.Pick)
+		}
+		odd := 0
+		for n := zone.Min; n <= zone.Max; n++ {
+			odd += n % 2
+		}
+		if distinct && (f.OddEven[0] > odd || f.OddEven[1] > size-odd) {
+			return fmt.Errorf("%s只有%d个奇数、%d个偶数", game.Name(), odd, size-odd)
+		}
+	}
+	//连号不超过 k 个时，每 k+1 个相邻号码中至少有一个不选
+	if f.MaxRun > 0 && distinct && zone.Pick > size-size/(f.MaxRun+1) {
+		return fmt.Errorf("%s最多%d个号码相连时选不出%d个号码", game.Name(), f.MaxRun, zone.Pick)
+	}
+	if f.Repeat != nil && f.Repeat.Min > zone.Pick {
+		return fmt.Errorf("%s重号个数不能多于每注的%d个", game.Name(), zone.Pick)
+	}
+	if len(f.ZoneRatio) > 0 {
+		if f.ZoneRatio[0]+f.ZoneRatio[1]+f.ZoneRatio[2] != zone.Pick {
+			return fmt.Errorf("%s三区比之和应为%d", game.Name(), zone.Pick)
+		}
+		areas := make([]int, 3)
+		for n := zone.Min; n <= zone.Max; n++ {
+			areas[zoneArea(zone, n)]++
+		}
+		for i, count := range f.ZoneRatio {
+			if distinct && count > areas[i] {
+				return fmt.Errorf("%s三区比第%d区只有%d个号码", game.Name(), i+1, areas[i])
+			}
+		}
+	}
+	return nil
+}
+
+// match 判断 numbers 是否满足过滤条件，previous 为上一期开奖号码
+func (f Filter) match(zone Zone, numbers []int, previous []int) bool {
+	picked := make(map[int]bool)
+	for _, n := range numbers {
+		picked[n] = true
+	}
+	for _, n := range f.Include {
+		if !picked[n] {
+			return false
+		}
+	}
+	for _, n := range f.Exclude {
+		if picked[n] {
+			return false
+		}
+	}
+
+	sorted := append([]int(nil), numbers...)
+	sort.Ints(sorted)
+	sum, odd := 0, 0
+	areas := make([]int, 3)
+	for _, n := range sorted {
+		sum += n
+		odd += n % 2
+		areas[zoneArea(zone, n)]++
+	}
+	if f.Sum != nil && (sum < f.Sum.Min || sum > f.Sum.Max) {
+		return false
+	}
+	if len(f.OddEven) > 0 && (odd != f.OddEven[0] || len(sorted)-odd != f.OddEven[1]) {
+		return false
+	}
+	if span := sorted[len(sorted)-1] - sorted[0]; f.Span != nil && (span < f.Span.Min || span > f.Span.Max) {
+		return false
+	}
+	if len(f.ZoneRatio) > 0 {
+		for i, count := range f.ZoneRatio {
+			if areas[i] != count {
+				return false
+			}
+		}
+	}
+
+	if f.MaxRun > 0 {
+		run := 1
+		for k := 1; k < len(sorted); k++ {
+			if sorted[k] == sorted[k-1] {
+				continue
+			}
+			if sorted[k] == sorted[k-1]+1 {
+				run++
+			} else {
+				run = 1
+			}
+			if run > f.MaxRun {
+				return false
+			}
+		}
+	}
+	if f.Repeat != nil {
+		repeats := 0
+		seen := make(map[int]bool)
+		for _, n := range previous {
+			if picked[n] && !seen[n] {
+				repeats++
+			}
+			seen[n] = true
+		}
+		if repeats < f.Repeat.Min || repeats > f.Repeat.Max {
+			return false
+		}
+	}
+	return true
+}
+
+// generateFiltered 用生成方式 g 生成号码，不满足过滤条件时用同一个 r 重新生成，
+// 相同的模型、请求和种子仍得到相同的号码；多次都不满足时返回错误
+func generateFiltered(g Generator, game Game, model *Model, req TicketRequest, r *rand.Rand) (Ticket, error) {
+	if req.Filter.empty() {
+		return g.Generate(game, model, req, r)
+	}
+	if err := req.Filter.check(game, req); err != nil {
+		return Ticket{}, err
+	}
+	zone, _ := filterZone(game, req.Play)
+	var previous []int
+	if len(model.History) > 0 {
+		previous = filterNumbers(game, model.History[len(model.History)-1])
+	}
+	for attempt := 0; attempt < maxFilterAttempts; attempt++ {
+		ticket, err := g.Generate(game, model, req, r)
+		if err != nil {
+			return Ticket{}, err
+		}
+		if req.Filter.match(zone, filterNumbers(game, ticket), previous) {
+			return ticket, nil
+		}
+	}
+	return Ticket{}, fmt.Errorf("%s生成%d次都不满足过滤条件，请放宽条件", game.Name(), maxFilterAttempts)
+}
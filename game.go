@@ -0,0 +1,574 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Zone 号码区：从 Min 到 Max 中选 Pick 个不重复的号码
+type Zone struct {
+	Name string
+	Pick int
+	Min  int
+	Max  int
+}
+
+// Play 玩法下的投注方式，如福彩3D的直选、组三、组六
+type Play struct {
+	Code string
+	Name string
+}
+
+// Ticket 一注号码，按号码区分组，每个区内升序（直选等按位置投注的除外）
+// 复式号码某些区选的号码多于 Zone.Pick，覆盖其中所有组合的单式号码
+// 胆拖号码的第一个区分为胆码 Bankers 和拖码 Zones[0]，每注都包含全部胆码
+type Ticket struct {
+	Play    string // 投注方式，玩法只有一种投注方式时为空
+	Bankers []int
+	Zones   [][]int
+}
+
+// withoutBankers 胆码并入第一个区，用于统计整注号码的命中数量
+func (t Ticket) withoutBankers() Ticket {
+	if len(t.Bankers) == 0 {
+		return t
+	}
+	zones := append([][]int(nil), t.Zones...)
+	zones[0] = append(append([]int(nil), t.Bankers...), t.Zones[0]...)
+	sort.Ints(zones[0])
+	return Ticket{Play: t.Play, Zones: zones}
+}
+
+// TicketRequest 生成号码的要求
+type TicketRequest struct {
+	Strategy string         // 生成方式，见 Generator
+	Params   map[string]int // 生成方式的参数
+	Play     string
+	Sizes    []int // 复式号码每个区选的个数，如双色球 8+2 为 {8, 2}；为空时生成单式号码
+	// 胆拖号码第一个区的胆码和指定的拖码，其余拖码由生成策略补足；
+	// 此时 Sizes[0] 为胆码和拖码的总数，不指定时比 Pick 多一个
+	Bankers []int
+	Drags   []int
+	Filter  Filter // 过滤条件，只支持单式号码
+}
+
+// Game 一种彩票玩法：号码区、开奖日历、计奖规则以及号码的存取格式
+type Game interface {
+	// Code 玩法代码，同时是接口 game 参数、数据库 game 字段的取值
+	Code() string
+	Name() string
+	Zones() []Zone
+	// ZonesFor 某种投注方式每注要选的号码，如快乐8选五只选5个
+	ZonesFor(play string) []Zone
+	Calendar() *DrawCalendar
+	// FirstIssue 第一期的期号，回补历史数据时从这里开始
+	FirstIssue() string
+	// Plays 支持的投注方式，第一个为默认；只有一种投注方式时为空
+	Plays() []Play
+	// RuleSetFor 返回某期开奖时生效的规则
+	RuleSetFor(issueCode string, drawDate string) *RuleSet
+	// SupportsCompound 是否可以投注复式号码
+	SupportsCompound() bool
+	// Generate 根据模型中的历史开奖号码生成一注号码，随机数都取自 r
+	Generate(model *Model, req TicketRequest, r *rand.Rand) (Ticket, error)
+	// ParseTicket 解析 tickets 表中保存的号码
+	ParseTicket(play string, numbers string) (Ticket, error)
+	// FormatTicket 将号码格式化为保存和返回给页面的字符串
+	FormatTicket(ticket Ticket) string
+	// DrawSizes 开奖号码在 red、blue 两列中各有几个
+	DrawSizes() (int, int)
+	// DrawNumbers 取出开奖结果中的号码
+	DrawNumbers(draw Draw) (Ticket, error)
+	// Grade 计算一注号码每个区命中的数量以及奖级，未中奖为 noPrize
+	Grade(ticket Ticket, drawn Ticket, rules *RuleSet) ([]int, int)
+}
+
+// zoneGame 是“每个区选若干个不重复号码、按各区命中数量定奖级”一类玩法的通用实现
+type zoneGame struct {
+	code       string
+	name       string
+	zones      []Zone
+	calendar   *DrawCalendar
+	firstIssue string
+	plays      []Play
+	compound   bool
+	ruleSets   []RuleSet
+}
+
+func (g *zoneGame) Code() string            { return g.code }
+func (g *zoneGame) Name() string            { return g.name }
+func (g *zoneGame) Zones() []Zone           { return g.zones }
+func (g *zoneGame) Calendar() *DrawCalendar { return g.calendar }
+func (g *zoneGame) FirstIssue() string      { return g.firstIssue }
+func (g *zoneGame) Plays() []Play           { return g.plays }
+
+func (g *zoneGame) ZonesFor(play string) []Zone { return g.zones }
+
+func (g *zoneGame) SupportsCompound() bool { return g.compound }
+
+func (g *zoneGame) RuleSetFor(issueCode string, drawDate string) *RuleSet {
+	return ruleSetFor(g.ruleSets, issueCode, drawDate)
+}
+
+// Generate 第一个区按马尔可夫链生成，其余的区以上一期的号码为条件或按历史出现频率生成，
+// 链的阶数、是否区分位置、平滑等参数见 markovConfig
+func (g *zoneGame) Generate(model *Model, req TicketRequest, r *rand.Rand) (Ticket, error) {
+	zones, err := ticketZones(g, req)
+	if err != nil {
+		return Ticket{}, err
+	}
+	config, err := newMarkovConfig(req.Params)
+	if err != nil {
+		return Ticket{}, err
+	}
+	ticket := Ticket{Play: req.Play}
+	for i, zone := range zones {
+		var numbers []int
+		if i == 0 {
+			fixed := fixedNumbers(g, req)
+			chain := model.markovChain(config)
+			if config.legacy() {
+				numbers = generateRedNumbers(chain.transition(), zone, fixed, req.Filter.Exclude, r) // 红球转移概率表
+			} else {
+				numbers = chain.generate(zone, fixed, req.Filter.Exclude, r)
+			}
+		} else if config.Blue {
+			numbers = pickWeighted(model.transitionWeights(i, zone, config.Smoothing), zone, nil, nil, r)
+		} else {
+			numbers = generateBlueNumbers(model.frequency(i), zone, nil, nil, r) // 蓝球频率表
+		}
+		// 每个区按升序排列
+		sort.Ints(numbers)
+		ticket.Zones = append(ticket.Zones, numbers)
+	}
+	return splitBankers(ticket, req.Bankers), nil
+}
+
+// ParseTicket 号码以空格分隔，各区依次排列，如双色球 "01 02 03 04 05 06 07"；
+// 复式号码的各区之间以 + 分隔，如 "01 02 03 04 05 06 07+01 02"；
+// 胆拖号码第一个区的胆码和拖码之间以 # 分隔，如 "01 02#03 04 05 06 07+01"；
+// 只有一个区的七乐彩复式号码没有 +，号码多于 Pick 个即为复式，如 "01 02 03 04 05 06 07 08"
+func (g *zoneGame) ParseTicket(play string, numbers string) (Ticket, error) {
+	ticket := Ticket{Play: play}
+	fields := strings.Fields(numbers)
+	if strings.ContainsAny(numbers, "+#") || g.compound && len(g.zones) == 1 && len(fields) > g.zones[0].Pick {
+		return g.parseCompound(play, numbers)
+	}
+	for _, zone := range g.zones {
+		if len(fields) < zone.Pick {
+			return ticket, fmt.Errorf("%s号码 %q 数量不足", g.name, numbers)
+		}
+		picked, err := parseZoneNumbers(fields[:zone.Pick], zone)
+		if err != nil {
+			return ticket, fmt.Errorf("%s号码 %q 格式错误: %w", g.name, numbers, err)
+		}
+		ticket.Zones = append(ticket.Zones, picked)
+		fields = fields[zone.Pick:]
+	}
+	if len(fields) > 0 {
+		return ticket, fmt.Errorf("%s号码 %q 数量过多", g.name, numbers)
+	}
+	return ticket, nil
+}
+
+func (g *zoneGame) parseCompound(play string, numbers string) (Ticket, error) {
+	ticket := Ticket{Play: play}
+	if !g.compound {
+		return ticket, fmt.Errorf("%s不支持复式号码: %q", g.name, numbers)
+	}
+	parts := strings.Split(numbers, "+")
+	if len(parts) != len(g.zones) {
+		return ticket, fmt.Errorf("%s复式号码 %q 应有%d个区", g.name, numbers, len(g.zones))
+	}
+	for i, zone := range g.zones {
+		part := parts[i]
+		if i == 0 && strings.Contains(part, "#") {
+			bankers, err := parseZoneNumbers(strings.Fields(part[:strings.Index(part, "#")]), zone)
+			if err != nil {
+				return ticket, fmt.Errorf("%s胆码 %q 格式错误: %w", g.name, numbers, err)
+			}
+			ticket.Bankers = bankers
+			part = part[strings.Index(part, "#")+1:]
+		}
+		fields := strings.Fields(part)
+		if i > 0 && len(fields) < zone.Pick {
+			return ticket, fmt.Errorf("%s复式号码 %q %s至少选%d个", g.name, numbers, zone.Name, zone.Pick)
+		}
+		picked, err := parseZoneNumbers(fields, zone)
+		if err != nil {
+			return ticket, fmt.Errorf("%s号码 %q 格式错误: %w", g.name, numbers, err)
+		}
+		ticket.Zones = append(ticket.Zones, picked)
+	}
+	if err := checkBankers(g, ticket.Bankers, ticket.Zones[0]); err != nil {
+		return ticket, fmt.Errorf("%s号码 %q 格式错误: %w", g.name, numbers, err)
+	}
+	return ticket, nil
+}
+
+// checkBankers 胆码为 1 到 Pick-1 个，拖码不能和胆码重复，胆码和拖码合计多于 Pick 个；
+// 没有胆码时第一个区至少选 Pick 个
+func checkBankers(g Game, bankers []int, drags []int) error {
+	zone := g.ZonesFor("")[0]
+	if len(bankers) == 0 {
+		if len(drags) < zone.Pick {
+			return fmt.Errorf("%s至少选%d个", zone.Name, zone.Pick)
+		}
+		return nil
+	}
+	if len(bankers) >= zone.Pick {
+		return fmt.Errorf("%s胆码应为1到%d个", zone.Name, zone.Pick-1)
+	}
+	for _, n := range drags {
+		for _, b := range bankers {
+			if n == b {
+				return fmt.Errorf("%s拖码 %02d 和胆码重复", zone.Name, n)
+			}
+		}
+	}
+	if len(bankers)+len(drags) <= zone.Pick {
+		return fmt.Errorf("%s胆码和拖码合计应多于%d个", zone.Name, zone.Pick)
+	}
+	return nil
+}
+
+// splitBankers 从第一个区的号码中分出胆码，其余的作为拖码
+func splitBankers(ticket Ticket, bankers []int) Ticket {
+	if len(bankers) == 0 {
+		return ticket
+	}
+	isBanker := make(map[int]bool)
+	for _, b := range bankers {
+		isBanker[b] = true
+	}
+	var drags []int
+	for _, n := range ticket.Zones[0] {
+		if !isBanker[n] {
+			drags = append(drags, n)
+		}
+	}
+	ticket.Bankers = append([]int(nil), bankers...)
+	sort.Ints(ticket.Bankers)
+	ticket.Zones[0] = drags
+	return ticket
+}
+
+// FormatTicket 单式号码各区之间以空格分隔，复式、胆拖号码各区之间以 + 分隔
+func (g *zoneGame) FormatTicket(ticket Ticket) string {
+	sep := " "
+	if len(ticket.Bankers) > 0 {
+		sep = "+"
+	}
+	for i, zone := range ticket.Zones {
+		if i < len(g.zones) && len(zone) > g.zones[i].Pick {
+			sep = "+"
+		}
+	}
+	var parts []string
+	for _, zone := range ticket.Zones {
+		parts = append(parts, formatNumbers(zone, " "))
+	}
+	if len(ticket.Bankers) > 0 {
+		parts[0] = formatNumbers(ticket.Bankers, " ") + "#" + parts[0]
+	}
+	return strings.Join(parts, sep)
+}
+
+func (g *zoneGame) DrawSizes() (int, int) {
+	blue := 0
+	for _, zone := range g.zones[1:] {
+		blue += zone.Pick
+	}
+	return g.zones[0].Pick, blue
+}
+
+// DrawNumbers 开奖结果中第一个区保存在 red，第二个区保存在 blue
+func (g *zoneGame) DrawNumbers(draw Draw) (Ticket, error) {
+	var ticket Ticket
+	columns := []string{draw.Red, draw.Blue}
+	for i, zone := range g.zones {
+		if i >= len(columns) {
+			break
+		}
+		numbers, err := parseNumbers(columns[i], ",")
+		if err != nil {
+			return ticket, err
+		}
+		if len(numbers) != zone.Pick {
+			return ticket, fmt.Errorf("第%s期%s数量错误: %s", draw.Code, zone.Name, columns[i])
+		}
+		ticket.Zones = append(ticket.Zones, numbers)
+	}
+	return ticket, nil
+}
+
+func (g *zoneGame) Grade(ticket Ticket, drawn Ticket, rules *RuleSet) ([]int, int) {
+	hits := make([]int, len(g.zones))
+	for i := range g.zones {
+		if i < len(ticket.Zones) && i < len(drawn.Zones) {
+			hits[i] = countHits(ticket.Zones[i], drawn.Zones[i])
+		}
+	}
+	if tier := rules.Grade(ticket.Play, hits...); tier != nil {
+		return hits, tier.Grade
+	}
+	return hits, noPrize
+}
+
+// parseZoneNumbers 解析一个区的号码并检查范围、重复，返回升序结果
+func parseZoneNumbers(fields []string, zone Zone) ([]int, error) {
+	seen := make(map[int]bool)
+	numbers := make([]int, 0, len(fields))
+	for _, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		if n < zone.Min || n > zone.Max {
+			return nil, fmt.Errorf("%s %d 超出范围 %d-%d", zone.Name, n, zone.Min, zone.Max)
+		}
+		if seen[n] {
+			return nil, fmt.Errorf("%s %d 重复", zone.Name, n)
+		}
+		seen[n] = true
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
+
+// ticketZones 按生成要求返回每个区要选的号码，复式号码每个区的个数在 Pick 和该区号码总数之间
+// 胆拖号码第一个区的个数包含胆码和拖码
+func ticketZones(g Game, req TicketRequest) ([]Zone, error) {
+	zones := append([]Zone(nil), g.ZonesFor(req.Play)...)
+	if len(req.Bankers) == 0 && len(req.Drags) > 0 {
+		return nil, fmt.Errorf("%s指定拖码时需要同时指定胆码", g.Name())
+	}
+	if len(req.Sizes) == 0 && len(req.Bankers) == 0 {
+		return zones, nil
+	}
+	if !g.SupportsCompound() {
+		return nil, fmt.Errorf("%s不支持复式、胆拖号码", g.Name())
+	}
+	if len(req.Bankers) > 0 {
+		fixed, err := parseZoneNumbers(strings.Fields(formatNumbers(append(append([]int(nil), req.Bankers...), req.Drags...), " ")), zones[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s胆码、拖码错误: %w", g.Name(), err)
+		}
+		if len(req.Sizes) == 0 {
+			req.Sizes = make([]int, len(zones))
+			for i := range zones {
+				req.Sizes[i] = zones[i].Pick
+			}
+			req.Sizes[0] = zones[0].Pick + 1
+		}
+		if req.Sizes[0] < len(fixed) {
+			return nil, fmt.Errorf("%s胆码和拖码共%d个，多于要选的%d个", g.Name(), len(fixed), req.Sizes[0])
+		}
+		if len(req.Bankers) >= zones[0].Pick || req.Sizes[0] <= zones[0].Pick {
+			return nil, fmt.Errorf("%s胆码应为1到%d个，胆码和拖码合计多于%d个", g.Name(), zones[0].Pick-1, zones[0].Pick)
+		}
+	}
+	if len(req.Sizes) != len(zones) {
+		return nil, fmt.Errorf("%s复式号码应指定%d个区的个数", g.Name(), len(zones))
+	}
+	for i := range zones {
+		if req.Sizes[i] < zones[i].Pick || req.Sizes[i] > zones[i].Max-zones[i].Min+1 {
+			return nil, fmt.Errorf("%s%s应选%d到%d个", g.Name(), zones[i].Name, zones[i].Pick, zones[i].Max-zones[i].Min+1)
+		}
+		zones[i].Pick = req.Sizes[i]
+	}
+	return zones, nil
+}
+
+// parseSizes 解析复式号码各区的个数，如 "8+2"
+func parseSizes(value string) ([]int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var sizes []int
+	for _, part := range strings.Split(value, "+") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("复式参数 %q 格式错误", value)
+		}
+		sizes = append(sizes, n)
+	}
+	return sizes, nil
+}
+
+// expandTicket 将复式号码展开为所覆盖的全部单式号码，单式号码返回自身
+func expandTicket(g Game, ticket Ticket) []Ticket {
+	zones := g.ZonesFor(ticket.Play)
+	singles := []Ticket{{Play: ticket.Play}}
+	for i, numbers := range ticket.Zones {
+		pick := len(numbers)
+		if i < len(zones) {
+			pick = zones[i].Pick
+		}
+		if i == 0 {
+			pick -= len(ticket.Bankers)
+		}
+		var next []Ticket
+		for _, single := range singles {
+			for _, combo := range combinations(numbers, pick) {
+				if i == 0 && len(ticket.Bankers) > 0 {
+					combo = append(append([]int(nil), ticket.Bankers...), combo...)
+					sort.Ints(combo)
+				}
+				zonesCopy := append(append([][]int(nil), single.Zones...), combo)
+				next = append(next, Ticket{Play: ticket.Play, Zones: zonesCopy})
+			}
+		}
+		singles = next
+	}
+	return singles
+}
+
+// ticketBets 号码包含的单式注数，如双色球 8+2 为 C(8,6)×C(2,1)=56 注，
+// 2个胆码、5个拖码 +1 为 C(5,4)=5 注
+func ticketBets(g Game, ticket Ticket) int {
+	zones := g.ZonesFor(ticket.Play)
+	bets := 1
+	for i, numbers := range ticket.Zones {
+		if i >= len(zones) {
+			continue
+		}
+		pick := zones[i].Pick
+		if i == 0 {
+			pick -= len(ticket.Bankers)
+		}
+		bets *= binomial(len(numbers), pick)
+	}
+	return bets
+}
+
+// combinations 返回从 numbers 中选 k 个的全部组合，保持原有顺序
+func combinations(numbers []int, k int) [][]int {
+	var result [][]int
+	combo := make([]int, 0, k)
+	var walk func(start int)
+	walk = func(start int) {
+		if len(combo) == k {
+			result = append(result, append([]int(nil), combo...))
+			return
+		}
+		for i := start; i <= len(numbers)-(k-len(combo)); i++ {
+			combo = append(combo, numbers[i])
+			walk(i + 1)
+			combo = combo[:len(combo)-1]
+		}
+	}
+	walk(0)
+	return result
+}
+
+// binomial 组合数 C(n,k)
+func binomial(n int, k int) int {
+	if k < 0 || k > n {
+		return 0
+	}
+	result := 1
+	for i := 1; i <= k; i++ {
+		result = result * (n - k + i) / i
+	}
+	return result
+}
+
+// countHits 统计 mine 中有多少个号码出现在 drawn 中
+func countHits(mine []int, drawn []int) int {
+	set := make(map[int]bool, len(drawn))
+	for _, n := range drawn {
+		set[n] = true
+	}
+	hits := 0
+	for _, n := range mine {
+		if set[n] {
+			hits++
+		}
+	}
+	return hits
+}
+
+// defaultGameCode 接口不带 game 参数时使用双色球，兼容旧页面
+const defaultGameCode = "ssq"
+
+var games = make(map[string]Game)
+var gameOrder []string
+
+func registerGame(g Game) {
+	games[g.Code()] = g
+	gameOrder = append(gameOrder, g.Code())
+}
+
+// gameByCode 按玩法代码查找，空串表示双色球
+func gameByCode(code string) (Game, error) {
+	if code == "" {
+		code = defaultGameCode
+	}
+	g, ok := games[code]
+	if !ok {
+		return nil, fmt.Errorf("不支持的玩法: %s", code)
+	}
+	return g, nil
+}
+
+// gamePlay 检查投注方式是否属于该玩法，空串表示默认的投注方式
+func gamePlay(g Game, play string) (string, error) {
+	plays := g.Plays()
+	if play == "" {
+		if len(plays) > 0 {
+			return plays[0].Code, nil
+		}
+		return "", nil
+	}
+	for _, p := range plays {
+		if p.Code == play {
+			return play, nil
+		}
+	}
+	return "", fmt.Errorf("%s不支持投注方式: %s", g.Name(), play)
+}
+
+// allGames 按注册顺序返回全部玩法
+func allGames() []Game {
+	list := make([]Game, 0, len(gameOrder))
+	for _, code := range gameOrder {
+		list = append(list, games[code])
+	}
+	return list
+}
+
+func init() {
+	registerGame(&zoneGame{
+		code: "ssq",
+		name: "双色球",
+		zones: []Zone{
+			{Name: "红球", Pick: 6, Min: 1, Max: 33},
+			{Name: "蓝球", Pick: 1, Min: 1, Max: 16},
+		},
+		calendar:   newDrawCalendar([]time.Weekday{time.Tuesday, time.Thursday, time.Sunday}, 21, 15, 20, 0),
+		firstIssue: "2003001",
+		compound:   true,
+		ruleSets:   ssqRuleSets,
+	})
+	registerGame(&zoneGame{
+		code: "dlt",
+		name: "大乐透",
+		zones: []Zone{
+			{Name: "前区", Pick: 5, Min: 1, Max: 35},
+			{Name: "后区", Pick: 2, Min: 1, Max: 12},
+		},
+		calendar:   newDrawCalendar([]time.Weekday{time.Monday, time.Wednesday, time.Saturday}, 21, 25, 20, 0),
+		firstIssue: "2007001",
+		compound:   true,
+		ruleSets:   dltRuleSets,
+	})
+	registerGame(newFc3dGame())
+	registerGame(newQlcGame())
+	registerGame(newKl8Game())
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// Generator 一种生成号码的方式，通过 /lottery 的 strategy 参数选择
+type Generator interface {
+	// Name 生成方式的名称，同时是 strategy 参数、tickets.strategy 字段的取值
+	Name() string
+	// Params 接受的参数及默认值，参数都是非负整数
+	Params() map[string]int
+	// Generate 按该玩法的模型（历史开奖号码按期号升序）生成一注号码，随机数都取自 r，
+	// 相同的模型、请求和种子得到相同的号码
+	Generate(game Game, model *Model, req TicketRequest, r *rand.Rand) (Ticket, error)
+}
+
+// paramChecker 需要检查参数取值范围的生成方式实现该接口
+type paramChecker interface {
+	CheckParams(params map[string]int) error
+}
+
+// defaultStrategy 不带 strategy 参数时的生成方式
+const defaultStrategy = "markov"
+
+var generators = make(map[string]Generator)
+var generatorOrder []string
+
+func registerGenerator(g Generator) {
+	generators[g.Name()] = g
+	generatorOrder = append(generatorOrder, g.Name())
+}
+
+// allGenerators 按注册顺序返回全部生成方式
+func allGenerators() []Generator {
+	var result []Generator
+	for _, name := range generatorOrder {
+		result = append(result, generators[name])
+	}
+	return result
+}
+
+// generatorByName 按名称查找生成方式，空串表示默认的马尔可夫链
+func generatorByName(name string) (Generator, error) {
+	if name == "" {
+		name = defaultStrategy
+	}
+	g, ok := generators[name]
+	if !ok {
+		return nil, fmt.Errorf("不支持的生成方式: %s", name)
+	}
+	return g, nil
+}
+
+// generatorParams 从请求参数中读取生成方式的参数，没有的取默认值
+func generatorParams(g Generator, form url.Values) (map[string]int, error) {
+	params := make(map[string]int)
+	for name, value := range g.Params() {
+		if v := form.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("%s参数 %s 应为非负整数", g.Name(), name)
+			}
+			value = n
+		}
+		params[name] = value
+	}
+	if checker, ok := g.(paramChecker); ok {
+		if err := checker.CheckParams(params); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+// parseParams 解析命令行的 -params 参数，格式和 tickets.params 相同，如 order=2&smoothing=1
+func parseParams(g Generator, value string) (map[string]int, error) {
+	form, err := url.ParseQuery(value)
+	if err != nil {
+		return nil, fmt.Errorf("参数格式错误: %w", err)
+	}
+	for name := range form {
+		if _, ok := g.Params()[name]; !ok {
+			return nil, fmt.Errorf("%s不支持参数 %s", g.Name(), name)
+		}
+	}
+	return generatorParams(g, form)
+}
+
+// encodeParams 参数按名称排序编码，如 window=30，保存在 tickets.params
+func encodeParams(params map[string]int) string {
+	values := url.Values{}
+	for name, value := range params {
+		values.Set(name, strconv.Itoa(value))
+	}
+	return values.Encode()
+}
+
+// randomGenerator 每个区均匀随机，即权重都为 0 的 weightedTicket
+type randomGenerator struct{}
+
+func (randomGenerator) Name() string           { return "random" }
+func (randomGenerator) Params() map[string]int { return nil }
+func (randomGenerator) Generate(game Game, model *Model, req TicketRequest, r *rand.Rand) (Ticket, error) {
+	return weightedTicket(game, req, r, func(int, Zone) map[int]float64 { return nil })
+}
+
+// markovGenerator 由各玩法自己实现，双色球等第一个区按马尔可夫链、其余区以上一期的号码为条件生成；
+// 参数只对双色球、大乐透、七乐彩有效，福彩3D、快乐8按频率生成
+type markovGenerator struct{}
+
+func (markovGenerator) Name() string { return "markov" }
+func (markovGenerator) Params() map[string]int {
+	params := make(map[string]int)
+	for name, value := range markovDefaults {
+		params[name] = value
+	}
+	return params
+}
+func (markovGenerator) CheckParams(params map[string]int) error {
+	_, err := newMarkovConfig(params)
+	return err
+}
+func (markovGenerator) Generate(game Game, model *Model, req TicketRequest, r *rand.Rand) (Ticket, error) {
+	return game.Generate(model, req, r)
+}
+
+// frequencyGenerator 按最近 window 期（0 为全部）每个号码出现的次数加权
+type frequencyGenerator struct{}
+
+func (frequencyGenerator) Name() string           { return "frequency" }
+func (frequencyGenerator) Params() map[string]int { return map[string]int{"window": 0} }
+func (frequencyGenerator) Generate(game Game, model *Model, req TicketRequest, r *rand.Rand) (Ticket, error) {
+	recent := recentHistory(model.History, req.Params["window"])
+	return weightedTicket(game, req, r, func(i int, zone Zone) map[int]float64 {
+		weights := make(map[int]float64)
+		for n, count := range zoneCounts(recent, i) {
+			weights[n] = float64(count)
+		}
+		return weights
+	})
+}
+
+// hotGenerator 热号：按最近 window 期出现次数的平方加权，更偏向近期频繁开出的号码
+type hotGenerator struct{}
+
+func (hotGenerator) Name() string           { return "hot" }
+func (hotGenerator) Params() map[string]int { return map[string]int{"window": 30} }
+func (hotGenerator) Generate(game Game, model *Model, req TicketRequest, r *rand.Rand) (Ticket, error) {
+	recent := recentHistory(model.History, req.Params["window"])
+	return weightedTicket(game, req, r, func(i int, zone Zone) map[int]float64 {
+		weights := make(map[int]float64)
+		for n, count := range zoneCounts(recent, i) {
+			weights[n] = float64(count * count)
+		}
+		return weights
+	})
+}
+
+// coldGenerator 冷号：按遗漏期数（距上次开出的期数，从未开出为总期数）加权，上一期开出的号码不选
+type coldGenerator struct{}
+
+func (coldGenerator) Name() string           { return "cold" }
+func (coldGenerator) Params() map[string]int { return nil }
+func (coldGenerator) Generate(game Game, model *Model, req TicketRequest, r *rand.Rand) (Ticket, error) {
+	return weightedTicket(game, req, r, func(i int, zone Zone) map[int]float64 {
+		weights := make(map[int]float64)
+		for n, omission := range zoneOmissions(model.History, i, zone) {
+			weights[n] = float64(omission)
+		}
+		return weights
+	})
+}
+
+// recentHistory 最近 window 期，0 表示全部
+func recentHistory(history []Ticket, window int) []Ticket {
+	if window > 0 && window < len(history) {
+		return history[len(history)-window:]
+	}
+	return history
+}
+
+// zoneCounts 第 i 个区每个号码出现的次数
+func zoneCounts(history []Ticket, i int) map[int]int {
+	counts := make(map[int]int)
+	for _, draw := range history {
+		if i < len(draw.Zones) {
+			for _, n := range draw.Zones[i] {
+				counts[n]++
+			}
+		}
+	}
+	return counts
+}
+
+// zoneOmissions 第 i 个区每个号码的遗漏期数
+func zoneOmissions(history []Ticket, i int, zone Zone) map[int]int {
+	omissions := make(map[int]int)
+	for n := zone.Min; n <= zone.Max; n++ {
+		omissions[n] = len(history)
+	}
+	for k, draw := range history {
+		if i < len(draw.Zones) {
+			for _, n := range draw.Zones[i] {
+				omissions[n] = len(history) - 1 - k
+			}
+		}
+	}
+	return omissions
+}
+
+// weightedTicket 每个区按 weights 返回的权重选号，胆拖号码的胆码和指定拖码先放入第一个区；
+// 组三、组六等对号码有要求的投注方式，不符合时重新生成
+func weightedTicket(game Game, req TicketRequest, r *rand.Rand, weights func(i int, zone Zone) map[int]float64) (Ticket, error) {
+	zones, err := ticketZones(game, req)
+	if err != nil {
+		return Ticket{}, err
+	}
+	zoneWeights := make([]map[int]float64, len(zones))
+	for i, zone := range zones {
+		zoneWeights[i] = weights(i, zone)
+	}
+
+	for attempt := 0; attempt < 1000; attempt++ {
+		ticket := Ticket{Play: req.Play}
+		for i, zone := range zones {
+			var fixed, exclude []int
+			if i == 0 {
+				fixed, exclude = fixedNumbers(game, req), req.Filter.Exclude
+			}
+			numbers := pickWeighted(zoneWeights[i], zone, fixed, exclude, r)
+			sort.Ints(numbers)
+			ticket.Zones = append(ticket.Zones, numbers)
+		}
+		ticket = splitBankers(ticket, req.Bankers)
+		if ticket, err = game.ParseTicket(req.Play, game.FormatTicket(ticket)); err == nil {
+			return ticket, nil
+		}
+	}
+	return Ticket{}, fmt.Errorf("%s多次生成的号码都不符合要求: %w", game.Name(), err)
+}
+
+// pickWeighted 按权重从 zone 中选不重复的号码补足到 zone.Pick 个，fixed 为事先定好的号码，exclude 中的号码不选；
+// 剩余号码的权重都为 0 时均匀选取
+func pickWeighted(weights map[int]float64, zone Zone, fixed []int, exclude []int, r *rand.Rand) []int {
+	result := append([]int(nil), fixed...)
+	selected := make(map[int]bool)
+	for _, n := range append(append([]int(nil), fixed...), exclude...) {
+		selected[n] = true
+	}
+	for len(result) < zone.Pick {
+		total := 0.0
+		for n := zone.Min; n <= zone.Max; n++ {
+			if !selected[n] {
+				total += weights[n]
+			}
+		}
+
+		var next int
+		if total == 0 {
+			next = randomUnselected(selected, zone, r)
+		} else {
+			x := r.Float64() * total
+			for n := zone.Min; n <= zone.Max; n++ {
+				if selected[n] || weights[n] == 0 {
+					continue
+				}
+				next = n
+				if x -= weights[n]; x < 0 {
+					break
+				}
+			}
+		}
+		result = append(result, next)
+		selected[next] = true
+	}
+	return result
+}
+
+func init() {
+	registerGenerator(randomGenerator{})
+	registerGenerator(markovGenerator{})
+	registerGenerator(frequencyGenerator{})
+	registerGenerator(hotGenerator{})
+	registerGenerator(coldGenerator{})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// kjggBaseUrl 福彩官网的开奖公告接口
+var kjggBaseUrl = "http://www.cwl.gov.cn/cwl_admin/front/cwlkj/search/kjxx/findDrawNotice"
+
+// throttle 保证两次请求之间至少间隔 interval，避免触发官网的访问频率限制
+type throttle struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// wait 距离上一次请求不足 interval 时阻塞等待
+func (t *throttle) wait() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.last.IsZero() {
+		if d := t.interval - time.Since(t.last); d > 0 {
+			time.Sleep(d)
+		}
+	}
+	t.last = time.Now()
+}
+
+// kjggClient 请求开奖公告接口，baseUrl 可以换成录制好的本地替身服务
+// name 为官网的玩法参数，如双色球 ssq
+type kjggClient struct {
+	throttle
+	client  *http.Client
+	baseUrl string
+	name    string
+}
+
+func newKjggClient(baseUrl string, name string, interval time.Duration) *kjggClient {
+	return &kjggClient{
+		throttle: throttle{interval: interval},
+		client:   &http.Client{Timeout: 10 * time.Second},
+		baseUrl:  baseUrl,
+		name:     name,
+	}
+}
+
+// findDrawNotice 查询开奖公告，params 为 issueCount、issueStart、dayStart、pageNo 等查询参数
+func (c *kjggClient) findDrawNotice(params url.Values) (KjggData, error) {
+	var kjggData KjggData
+
+	query := url.Values{}
+	for k, v := range params {
+		query[k] = v
+	}
+	query.Set("name", c.name)
+
+	req, err := http.NewRequest("GET", c.baseUrl+"?"+query.Encode(), nil)
+	if err != nil {
+		return kjggData, err
+	}
+	req.Header.Add("Referer", "http://www.cwl.gov.cn/ygkj/kjgg/")
+	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/97.0.4692.99 Safari/537.36")
+	req.Header.Add("X-Requested-With", "XMLHttpRequest")
+	req.Header.Add("Accept", "application/json, text/javascript, */*; q=0.01")
+	req.Header.Add("Cookie", "_ga=GA1.3.1940681231.1595247885; HMF_CI=a9decaf585b61e962b2d7563d6120430c8baebe64c03b6b525f7807d8433cad4e4; 21_vq=15")
+
+	c.wait()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return kjggData, fmt.Errorf("请求开奖公告失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	result, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return kjggData, fmt.Errorf("读取开奖公告失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return kjggData, fmt.Errorf("请求开奖公告失败，状态码: %d", resp.StatusCode)
+	}
+
+	if err = json.Unmarshal(result, &kjggData); err != nil {
+		return kjggData, fmt.Errorf("结构化开奖公告结果发生错误: %w", err)
+	}
+	if kjggData.State != 0 {
+		return kjggData, fmt.Errorf("开奖公告接口返回错误: %d %s", kjggData.State, kjggData.Message)
+	}
+	return kjggData, nil
+}
+
+// cwlDrawSource 从福彩官网（或提供同样接口的替身服务）获取开奖结果
+type cwlDrawSource struct {
+	client   *kjggClient
+	pageSize int
+}
+
+func newCwlDrawSource(baseUrl string, name string, interval time.Duration) *cwlDrawSource {
+	return &cwlDrawSource{client: newKjggClient(baseUrl, name, interval), pageSize: 30}
+}
+
+func (c *cwlDrawSource) Latest(n int) ([]KjggItem, error) {
+	data, err := c.client.findDrawNotice(url.Values{"issueCount": {strconv.Itoa(n)}})
+	if err != nil {
+		return nil, err
+	}
+	sortKjggItems(data.Result)
+	return data.Result, nil
+}
+
+func (c *cwlDrawSource) Range(from string, to string) ([]KjggItem, error) {
+	return c.fetchAll(url.Values{"issueStart": {from}, "issueEnd": {to}})
+}
+
+func (c *cwlDrawSource) DayRange(dayStart string, dayEnd string) ([]KjggItem, error) {
+	return c.fetchAll(url.Values{"dayStart": {dayStart}, "dayEnd": {dayEnd}})
+}
+
+// fetchAll 按 PageCount 逐页请求，直到取完 CountNum 期
+func (c *cwlDrawSource) fetchAll(params url.Values) ([]KjggItem, error) {
+	params.Set("pageSize", strconv.Itoa(c.pageSize))
+
+	var items []KjggItem
+	for pageNo := 1; ; pageNo++ {
+		params.Set("pageNo", strconv.Itoa(pageNo))
+		data, err := c.client.findDrawNotice(params)
+		if err != nil {
+			return nil, fmt.Errorf("请求第%d页失败: %w", pageNo, err)
+		}
+		items = append(items, data.Result...)
+		if pageNo >= data.PageCount || len(data.Result) == 0 {
+			if data.CountNum > 0 && len(items) != data.CountNum {
+				fmt.Printf("开奖公告共%d期，实际取到%d期\n", data.CountNum, len(items))
+			}
+			break
+		}
+	}
+	sortKjggItems(items)
+	return items, nil
+}
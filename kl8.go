@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// kl8DrawCount 快乐8每期从 1-80 中开出20个号码
+const kl8DrawCount = 20
+
+// kl8Game 快乐8：从 1-80 中选 1 到 10 个号码，按选的个数分为选一到选十，
+// 每种投注方式按命中开奖号码的个数计奖
+type kl8Game struct {
+	zoneGame
+}
+
+func newKl8Game() *kl8Game {
+	//从选十到选一，默认选十
+	names := []string{"一", "二", "三", "四", "五", "六", "七", "八", "九", "十"}
+	var plays []Play
+	for n := len(names); n >= 1; n-- {
+		plays = append(plays, Play{Code: fmt.Sprintf("x%d", n), Name: "选" + names[n-1]})
+	}
+
+	return &kl8Game{zoneGame{
+		code: "kl8",
+		name: "快乐8",
+		zones: []Zone{
+			{Name: "号码", Pick: 10, Min: 1, Max: 80},
+		},
+		calendar:   newDrawCalendar(everyDay, 21, 30, 20, 0),
+		firstIssue: "2020001",
+		plays:      plays,
+		ruleSets:   kl8RuleSets,
+	}}
+}
+
+// pickCount 投注方式 x5 表示选五
+func (g *kl8Game) pickCount(play string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(play, "x"))
+	if err != nil || !strings.HasPrefix(play, "x") || n < 1 || n > g.zones[0].Pick {
+		return 0, fmt.Errorf("快乐8不支持投注方式: %s", play)
+	}
+	return n, nil
+}
+
+func (g *kl8Game) ZonesFor(play string) []Zone {
+	zone := g.zones[0]
+	if n, err := g.pickCount(play); err == nil {
+		zone.Pick = n
+	}
+	return []Zone{zone}
+}
+
+func (g *kl8Game) ParseTicket(play string, numbers string) (Ticket, error) {
+	ticket := Ticket{Play: play}
+	n, err := g.pickCount(play)
+	if err != nil {
+		return ticket, err
+	}
+	fields := strings.Fields(numbers)
+	if len(fields) != n {
+		return ticket, fmt.Errorf("快乐8选%d号码 %q 数量错误", n, numbers)
+	}
+	picked, err := parseZoneNumbers(fields, g.ZonesFor(play)[0])
+	if err != nil {
+		return ticket, fmt.Errorf("快乐8号码 %q 格式错误: %w", numbers, err)
+	}
+	ticket.Zones = [][]int{picked}
+	return ticket, nil
+}
+
+// Generate 按历史开奖中各号码出现的频率选出投注方式要求的个数
+func (g *kl8Game) Generate(model *Model, req TicketRequest, r *rand.Rand) (Ticket, error) {
+	play := req.Play
+	zones := g.ZonesFor(play)
+	if _, err := g.pickCount(play); err != nil {
+		return Ticket{}, err
+	}
+	numbers := generateBlueNumbers(model.frequency(0), zones[0], req.Filter.Include, req.Filter.Exclude, r)
+	sort.Ints(numbers)
+	return Ticket{Play: play, Zones: [][]int{numbers}}, nil
+}
+
+func (g *kl8Game) DrawSizes() (int, int) {
+	return kl8DrawCount, 0
+}
+
+// DrawNumbers 20个开奖号码都保存在 red
+func (g *kl8Game) DrawNumbers(draw Draw) (Ticket, error) {
+	numbers, err := parseNumbers(draw.Red, ",")
+	if err != nil {
+		return Ticket{}, err
+	}
+	if len(numbers) != kl8DrawCount {
+		return Ticket{}, fmt.Errorf("第%s期快乐8开奖号码应有%d个，实际%d个", draw.Code, kl8DrawCount, len(numbers))
+	}
+	return Ticket{Zones: [][]int{numbers}}, nil
+}
+
+// Grade 返回命中开奖号码的个数
+func (g *kl8Game) Grade(ticket Ticket, drawn Ticket, rules *RuleSet) ([]int, int) {
+	hits := []int{countHits(ticket.Zones[0], drawn.Zones[0])}
+	if tier := rules.Grade(ticket.Play, hits...); tier != nil {
+		return hits, tier.Grade
+	}
+	return hits, noPrize
+}
@@ -1,29 +1,31 @@
 package main
 
 import (
-	"crypto/rand"
 	"database/sql"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
-	"math/big"
 	"net/http"
-	"os"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	"io/ioutil"
-
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/robfig/cron"
 )
 
 type Lotterys struct {
 	Id            int            `json:"id"`
+	Game          string         `json:"game"`
+	Play          string         `json:"play"`
 	Lottery       string         `json:"lottery"`
+	Bets          int            `json:"bets"` // 单式注数，复式号码大于1
+	Cost          float64        `json:"cost"`
+	Tiers         map[int]int    `json:"tiers"`    // 各奖级中奖注数
+	Strategy      string         `json:"strategy"` // 生成方式
+	Params        string         `json:"params"`
 	CreateTime    sql.NullTime   `json:"create_time"`
 	Code          sql.NullString `json:"code"`
 	DetailsLink   string         `json:"detailsLink"`
@@ -36,6 +38,7 @@ type Lotterys struct {
 	PoolMoney     string         `json:"poolmoney"`
 	Content       string         `json:"content"`
 	MyPrizeGrade  sql.NullInt32  `json:"myPrizeGrade"`
+	PrizeMoney    float64        `json:"prizeMoney"`
 	CreateTimeStr string         `json:"create_time_str"`
 	RedCount      sql.NullInt32
 	BlueCount     sql.NullInt32
@@ -81,701 +84,588 @@ type PrizeGradesItem struct {
 }
 
 type LotteryDatas struct {
-	TotalCount  int `json:"totalcount"`
-	FirstCount  int `json:"firstcount"`
-	SecondCount int `json:"secondcount"`
-	ThirdCount  int `json:"thirdcount"`
-	ForthCount  int `json:"forthcount"`
-	FifthCount  int `json:"fifthcount"`
-	SixthCount  int `json:"sixthcount"`
+	TotalCount      int                    `json:"totalcount"`
+	FirstCount      int                    `json:"firstcount"`
+	SecondCount     int                    `json:"secondcount"`
+	ThirdCount      int                    `json:"thirdcount"`
+	ForthCount      int                    `json:"forthcount"`
+	FifthCount      int                    `json:"fifthcount"`
+	SixthCount      int                    `json:"sixthcount"`
+	LuckyCount      int                    `json:"luckycount"`      //福运奖
+	TotalCost       float64                `json:"totalcost"`       //投入（元）
+	TotalPrize      float64                `json:"totalprize"`      //奖金（元）
+	ROI             float64                `json:"roi"`             //已开奖号码的回报率：(奖金-投入)/投入
+	GradeCounts     map[int]int            `json:"gradecounts"`     //各奖级中奖数量，不同玩法奖级数不同
+	PlayGradeCounts map[string]map[int]int `json:"playgradecounts"` //按投注方式分开的各奖级中奖数量，如快乐8选十、选五
 }
 
 var port = flag.String("p", "5134", "指定端口")
-var db *sql.DB
-var kjggUrl = "http://www.cwl.gov.cn/cwl_admin/front/cwlkj/search/kjxx/findDrawNotice?name=ssq&issueCount=30"
-var kjggHistoryUrl = "http://www.cwl.gov.cn/cwl_admin/front/cwlkj/search/kjxx/findDrawNotice?name=ssq&issueCount=&issueStart=&issueEnd=&dayStart=2021-11-28&dayEnd=2022-02-08"
-
-var redHistory [][]int
-var blueHistory []int
+var dbPath = flag.String("db", "serverDB.db", "sqlite数据库文件路径")
+var drawSourceSpec = flag.String("source", "cwl", "开奖数据源：cwl、cwl:<url>、sporttery、file:<path>，多个玩法用逗号分隔，如 cwl,dlt=sporttery")
+var fetchInterval = flag.Duration("fetch-interval", 2*time.Second, "请求开奖公告接口的最小间隔")
+var suspensionsPath = flag.String("suspensions", "suspensions.json", "休市日期配置文件")
+var migrateDryRun = flag.Bool("migrate-dry-run", false, "只试运行待执行的数据库迁移并回滚，不启动服务")
+var randomSpec = flag.String("random", "crypto", "生成号码的随机数来源：crypto，或 seed:<n> 以固定种子生成可重复的序列")
+
+// server 持有各个 handler 共用的依赖
+type server struct {
+	store   *LotteryStore
+	sources map[string]DrawSource // 玩法 -> 开奖数据源
+	models  *modelCache           // 各玩法训练好的模型，开奖结果入库后增量更新
+	random  RandomSource          // 每注号码的随机数种子
+}
 
 func main() {
 	flag.Parse()
 
-	initLotterySqlite()
-	defer db.Close()
-
-	var err error
-	_, err = strconv.Atoi(*port)
+	store, err := OpenLotteryStore(*dbPath)
 	if err != nil {
-		*port = "5134"
+		fmt.Println("初始化数据库失败:", err)
+		return
 	}
+	defer store.Close()
 
-	// Create a simple file server
-	fs := http.FileServer(http.Dir("./public"))
-	http.Handle("/", fs)
-
-	//http request response
-	//http.HandleFunc("/lottery", lotteryFunc)
-	http.HandleFunc("/lottery", lotteryFuncUseMarkov)
-	http.HandleFunc("/lotteryHistory", lotteryHistoryFunc)
-	http.HandleFunc("/lotteryHistoryWithPage", lotteryHistoryFuncWithPage)
-	http.HandleFunc("/queryKjgg", queryKjggImpl)
-	http.HandleFunc("/loadData", loadDataImpl)
-
-	redHistory, blueHistory, err = readHistoryDataFromSql("serverDB.db")
+	applied, err := store.Migrate(*migrateDryRun)
 	if err != nil {
-		fmt.Printf("读取历史数据失败：%v\n", err)
+		fmt.Println("数据库迁移失败:", err)
 		return
 	}
-
-	//准备启动定时器 定时查询开奖公告以及历史开奖公告
-	c := cron.New()
-	c.AddFunc("0 40 21 * * ?", queryKjgg) //每天21点31分
-	//c.AddFunc("*/10 * * * * ?", queryKjgg) //每10秒
-	c.Start()
-	defer c.Stop()
-
-	go queryKjgg()
-
-	fmt.Println("准备启动服务,端口:", *port)
-	err = http.ListenAndServe(":"+*port, nil)
-	if err != nil {
-		fmt.Println("启动http服务失败:", err)
+	for _, m := range applied {
+		if *migrateDryRun {
+			fmt.Printf("待执行迁移 %d：%s（试运行成功）\n", m.version, m.description)
+		} else {
+			fmt.Printf("已执行迁移 %d：%s\n", m.version, m.description)
+		}
+	}
+	if *migrateDryRun {
+		if len(applied) == 0 {
+			fmt.Println("数据库已是最新版本")
+		}
 		return
 	}
-}
 
-func lotteryFunc(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		io.WriteString(w, "只允许POST请求")
+	specs, err := parseDrawSourceSpecs(*drawSourceSpec)
+	if err != nil {
+		fmt.Println("解析开奖数据源失败:", err)
 		return
 	}
-
-	var cnt = 0
-	var redBalls []int64
-	var blueBall int64
-	//红区 1-33  6个号码
-	for cnt < 6 {
-		n, err := rand.Int(rand.Reader, big.NewInt(33))
-		if err != nil {
-			fmt.Println("rand int error:", err)
-			continue
-		}
-		//排除重复数字
-		regenerate := false
-		for i := 0; i < len(redBalls); i++ {
-			if redBalls[i] == n.Int64() {
-				regenerate = true
-				break
-			}
-		}
-		if regenerate {
-			continue
+	sources := make(map[string]DrawSource)
+	for _, game := range allGames() {
+		if sources[game.Code()], err = newDrawSource(game, specs[game.Code()], *fetchInterval); err != nil {
+			fmt.Println("初始化", game.Name(), "开奖数据源失败:", err)
+			return
 		}
-		cnt += 1
-		redBalls = append(redBalls, n.Int64()+1)
 	}
 
-	qsort(redBalls, 0, len(redBalls)-1)
-
-	//蓝区 1-16 1个号码
-	cnt = 0
-	for cnt < 1 {
-		n, err := rand.Int(rand.Reader, big.NewInt(16))
-		if err != nil {
-			fmt.Println("rand int error:", err)
-			continue
+	//休市日期对所有玩法都生效，子命令也要用到开奖日历，先于子命令读取
+	for _, game := range allGames() {
+		if err = game.Calendar().LoadSuspensions(*suspensionsPath); err != nil {
+			fmt.Println("读取休市日期失败:", err)
+			return
 		}
-		cnt += 1
-		blueBall = n.Int64() + 1
 	}
 
-	var resultStr string
-	for index := range redBalls {
-		redStr := strconv.FormatInt(redBalls[index], 10)
-		if len(redStr) < 2 {
-			redStr = "0" + redStr //单数补0
+	//子命令：按各期生效的规则重新计奖
+	if flag.Arg(0) == "regrade" {
+		s := &server{store: store}
+		if err = s.regradeTickets(); err != nil {
+			fmt.Println("重新计奖失败:", err)
 		}
-		resultStr += redStr + " "
+		return
 	}
 
-	blueStr := strconv.FormatInt(blueBall, 10)
-	if len(blueStr) < 2 {
-		blueStr = "0" + blueStr //单数补0
+	//子命令：用库中的开奖历史回测各生成方式
+	if flag.Arg(0) == "backtest" {
+		if err = runBacktest(store, flag.Args()[1:]); err != nil {
+			fmt.Println("回测失败:", err)
+		}
+		return
 	}
-	resultStr += blueStr
-
-	//将生成结果保存到sqlite数据库中
-	record(resultStr)
 
-	var bts = []byte(resultStr)
-	w.Write(bts)
-}
-
-func lotteryFuncUseMarkov(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		io.WriteString(w, "只允许POST请求")
+	//子命令：蒙特卡洛模拟某种生成方式的期望回报和方差
+	if flag.Arg(0) == "simulate" {
+		if err = runSimulate(store, flag.Args()[1:]); err != nil {
+			fmt.Println("模拟失败:", err)
+		}
 		return
 	}
 
-	// 2. 构建概率模型
-	redTransition := buildRedTransition(redHistory) // 红球转移概率表
-	blueProbs := buildBlueProbability(blueHistory)  // 蓝球频率表
-
-	// 3. 生成号码
-	redNumbers := generateRedNumbers(redTransition) // 生成红球
-	blueNumber := generateBlueNumber(blueProbs)     // 生成蓝球
-
-	// 4. 输出结果（红球按升序排列，符合双色球规则）
-	sort.Ints(redNumbers)
-	// fmt.Printf("🎫 双色球号码：\n")
-	// fmt.Printf("红球：%v\n", redNumbers)
-	// fmt.Printf("蓝球：%d\n", blueNumber)
-
-	var resultStr string
-	for index := range redNumbers {
-		redStr := strconv.FormatInt(int64(redNumbers[index]), 10)
-		if len(redStr) < 2 {
-			redStr = "0" + redStr //单数补0
+	//子命令：用保存的种子复现某一注号码
+	if flag.Arg(0) == "reproduce" {
+		if err = runReproduce(store, flag.Args()[1:]); err != nil {
+			fmt.Println("复现号码失败:", err)
 		}
-		resultStr += redStr + " "
+		return
 	}
 
-	blueStr := strconv.FormatInt(int64(blueNumber), 10)
-	if len(blueStr) < 2 {
-		blueStr = "0" + blueStr //单数补0
+	//子命令：回补历史开奖数据
+	if flag.Arg(0) == "backfill" {
+		if err = runBackfill(store, sources, flag.Args()[1:]); err != nil {
+			fmt.Println("回补历史开奖数据失败:", err)
+		}
+		return
 	}
-	resultStr += blueStr
-
-	//将生成结果保存到sqlite数据库中
-	record(resultStr)
-
-	var bts = []byte(resultStr)
-	w.Write(bts)
-}
-
-func lotteryHistoryFunc(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		io.WriteString(w, "只允许POST请求")
+	random, err := newRandomSource(*randomSpec)
+	if err != nil {
+		fmt.Println("初始化随机数来源失败:", err)
 		return
 	}
+	s := &server{store: store, sources: sources, models: newModelCache(), random: random}
 
-	results := getRecord()
-
-	bts, err := json.Marshal(results)
+	_, err = strconv.Atoi(*port)
 	if err != nil {
-		io.WriteString(w, "序列化查询结果失败")
-		return
+		*port = "5134"
 	}
-	io.WriteString(w, string(bts))
-}
 
-func lotteryHistoryFuncWithPage(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		io.WriteString(w, "只允许POST请求")
-		return
+	// Create a simple file server
+	fs := http.FileServer(http.Dir("./public"))
+	http.Handle("/", fs)
+
+	//http request response
+	http.HandleFunc("/lottery", s.lotteryFunc)
+	http.HandleFunc("/lotteryHistory", s.lotteryHistoryFunc)
+	http.HandleFunc("/lotteryHistoryWithPage", s.lotteryHistoryFuncWithPage)
+	http.HandleFunc("/queryKjgg", s.queryKjggImpl)
+	http.HandleFunc("/loadData", s.loadDataImpl)
+	http.HandleFunc("/models", s.modelsFunc)
+	http.HandleFunc("/commitment", s.commitmentFunc)
+	http.HandleFunc("/verify", s.verifyFunc)
+	http.HandleFunc("/api/stats", s.statsFunc)
+	http.HandleFunc("/api/trend", s.trendFunc)
+
+	for _, game := range allGames() {
+		if err = s.models.Load(store, game); err != nil {
+			fmt.Printf("读取%s历史数据失败：%v\n", game.Name(), err)
+			return
+		}
 	}
 
-	r.ParseForm()
-	page := r.Form.Get("page")
-	pagecount := r.Form.Get("pagecount")
-	//fmt.Printf("page: %s pagecount: %s\n", page, pagecount)
+	//准备启动定时器 每个玩法开奖后25分钟查询开奖公告，休市期间不查询
+	c := cron.New()
+	for _, game := range allGames() {
+		game := game
+		c.Schedule(drawSchedule{calendar: game.Calendar(), delay: 25 * time.Minute}, cron.FuncJob(func() { s.queryGameKjgg(game) }))
+	}
+	//c.AddFunc("*/10 * * * * ?", s.queryKjgg) //每10秒
+	c.Start()
+	defer c.Stop()
 
-	results := getRecordWithPage(page, pagecount)
+	go s.queryKjgg()
 
-	bts, err := json.Marshal(results)
+	fmt.Println("准备启动服务,端口:", *port)
+	err = http.ListenAndServe(":"+*port, nil)
 	if err != nil {
-		io.WriteString(w, "序列化查询结果失败")
+		fmt.Println("启动http服务失败:", err)
 		return
 	}
-	io.WriteString(w, string(bts))
 }
 
-func qsort(arr []int64, start int, end int) {
-	if start >= end {
-		return
+// requestTicket 读取 strategy 生成方式及其参数、play 投注方式、compound 复式参数（如 compound=8+2）、
+// bankers 胆码、drags 拖码（空格或逗号分隔，如 bankers=01 05）以及过滤条件（见 parseFilter）
+func requestTicket(game Game, r *http.Request) (TicketRequest, error) {
+	generator, err := generatorByName(r.Form.Get("strategy"))
+	if err != nil {
+		return TicketRequest{}, err
 	}
-
-	key := start
-	value := arr[start]
-	for n := start + 1; n <= end; n++ {
-		if arr[n] < value {
-			arr[key] = arr[n]
-			arr[n] = arr[key+1]
-			key++
-		}
+	params, err := generatorParams(generator, r.Form)
+	if err != nil {
+		return TicketRequest{}, err
 	}
+	play, err := gamePlay(game, r.Form.Get("play"))
+	if err != nil {
+		return TicketRequest{}, err
+	}
+	sizes, err := parseSizes(r.Form.Get("compound"))
+	if err != nil {
+		return TicketRequest{}, err
+	}
+	bankers, err := parseNumbers(strings.ReplaceAll(r.Form.Get("bankers"), " ", ","), ",")
+	if err != nil {
+		return TicketRequest{}, fmt.Errorf("胆码%w", err)
+	}
+	drags, err := parseNumbers(strings.ReplaceAll(r.Form.Get("drags"), " ", ","), ",")
+	if err != nil {
+		return TicketRequest{}, fmt.Errorf("拖码%w", err)
+	}
+	filter, err := parseFilter(r.Form)
+	if err != nil {
+		return TicketRequest{}, err
+	}
+	req := TicketRequest{Strategy: generator.Name(), Params: params, Play: play, Sizes: sizes, Bankers: bankers, Drags: drags, Filter: filter}
+	if err = filter.check(game, req); err != nil {
+		return TicketRequest{}, err
+	}
+	return req, nil
+}
 
-	arr[key] = value
-
-	qsort(arr, start, key-1)
-	qsort(arr, key+1, end)
+// requestGame 读取请求中的 game 参数，没有时为双色球
+func requestGame(r *http.Request) (Game, error) {
+	r.ParseForm()
+	return gameByCode(r.Form.Get("game"))
 }
 
-func initLotterySqlite() {
-	absDir, err := os.Getwd()
+// lotteryFunc 按 strategy 参数选择的生成方式生成一注号码，默认为马尔可夫链；
+// 带 count 参数时一次生成多注，以 JSON 返回；带 clientSeed 参数时号码可在开奖后用 /verify 验证
+func (s *server) lotteryFunc(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		io.WriteString(w, "只允许POST请求")
+		return
+	}
+	game, err := requestGame(r)
 	if err != nil {
-		fmt.Println("获取程序工作目录失败，错误描述：" + err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	db, err = sql.Open("sqlite3", absDir+"/serverDB.db")
+	req, err := requestTicket(game, r)
 	if err != nil {
-		fmt.Printf("sqlite open failed:[%v]", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer db.Close()
 
-	tableSql := `CREATE TABLE IF NOT EXISTS "lottery" (
-		"id" INTEGER PRIMARY KEY AUTOINCREMENT,
-		"lottery" varchar(32) NULL,
-		"create_time" TIMESTAMP default (datetime('now', 'localtime')),
-		"code" varchar(8) NULL,
-		"details_link" varchar(64) NULL,
-		"video_link" varchar(64) NULL,
-		"date" varchar(32) NULL,
-		"week" varchar(8) NULL,
-		"red" varchar(16) NULL,
-		"blue" varchar(8) NULL,
-		"sales" varchar(16) NULL,
-		"pool_money" varchar(16) NULL,
-		"content" varchar(255) NULL,
-		"my_prize_grade" tinyint(2) NULL,
-		"red_count" tinyint(2) NULL,
-		"blue_count" tinyint(2) NULL
-	  );`
-	_, err = db.Exec(tableSql)
-	if err != nil {
-		fmt.Println("初始化表格失败:", err)
-		panic(err)
+	//停售期间（开奖日20:00至开奖、休市）不生成号码
+	now := time.Now()
+	if !game.Calendar().SalesOpen(now) {
+		http.Error(w, "当前停售，请开奖后再来", http.StatusForbidden)
+		return
 	}
-}
 
-func record(str string) {
-	absDir, err := os.Getwd()
-	if err != nil {
-		fmt.Println("获取程序工作目录失败，错误描述：" + err.Error())
+	if _, err = ticketZones(game, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	db, err := sql.Open("sqlite3", absDir+"/serverDB.db")
+	//期号只算一次，clientSeed 的服务端种子和保存的号码用同一期，开奖结果在中途入库也不会不一致
+	issueCode, err := s.store.targetIssueCode(game, now)
 	if err != nil {
-		fmt.Printf("sqlite open failed:[%v]", err.Error())
+		fmt.Println("计算期号失败:", err)
+		http.Error(w, "计算期号失败", http.StatusInternalServerError)
 		return
 	}
-	defer db.Close()
-
-	insertStr := "insert into lottery (lottery) values(?);"
-	stmt, err := db.Prepare(insertStr)
+	random, err := s.requestRandom(game, r, issueCode)
 	if err != nil {
-		fmt.Println("Prepare error:", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	res, err := stmt.Exec(str)
-	if err != nil {
-		fmt.Println("Exec error:", err)
+	if r.Form.Get("count") != "" {
+		s.lotteryBatch(w, r, game, req, random, issueCode)
 		return
 	}
-	id, err := res.LastInsertId()
+
+	ticket, provenance, err := s.generateTicket(game, req, random)
 	if err != nil {
-		fmt.Println("LastInsertId error:", err)
+		fmt.Println("生成号码失败:", err)
+		http.Error(w, "生成号码失败", http.StatusInternalServerError)
 		return
 	}
-	fmt.Println("新增id:", id)
+
+	s.saveTicket(w, game, req, ticket, provenance, issueCode)
 }
 
-func getRecord() []Lotterys {
-	absDir, err := os.Getwd()
+// generateTicket 从随机数来源 random 取一个种子，用缓存的模型生成一注号码
+func (s *server) generateTicket(game Game, req TicketRequest, random RandomSource) (Ticket, Provenance, error) {
+	provenance, err := random.Seed()
 	if err != nil {
-		fmt.Println("获取程序工作目录失败，错误描述：" + err.Error())
-		return nil
+		return Ticket{}, Provenance{}, err
 	}
-	db, err := sql.Open("sqlite3", absDir+"/serverDB.db")
+	ticket, modelIssue, err := s.models.Generate(game, req, provenance.Seed)
 	if err != nil {
-		fmt.Printf("sqlite open failed:[%v]", err.Error())
-		return nil
+		return Ticket{}, Provenance{}, err
+	}
+	provenance.ModelIssue, provenance.Request = modelIssue, encodeRequest(req)
+	return ticket, provenance, nil
+}
+
+// newTicketRecord 待保存的号码，记录生成方式、参数和复现号码所需的种子
+func newTicketRecord(game Game, req TicketRequest, ticket Ticket, provenance Provenance) TicketRecord {
+	return TicketRecord{
+		Ticket:     ticket,
+		Numbers:    game.FormatTicket(ticket),
+		Bets:       ticketBets(game, ticket),
+		Strategy:   req.Strategy,
+		Params:     encodeParams(req.Params),
+		Provenance: provenance,
 	}
-	defer db.Close()
+}
+
+// saveTicket 保存参与 issueCode 期的号码，把号码写回给页面
+func (s *server) saveTicket(w http.ResponseWriter, game Game, req TicketRequest, ticket Ticket, provenance Provenance, issueCode string) {
+	record := newTicketRecord(game, req, ticket, provenance)
 
-	querySql := "select id, lottery, create_time,code, date, red, blue, my_prize_grade from lottery order by create_time desc;"
-	stmt, err := db.Prepare(querySql)
+	//将生成结果保存到sqlite数据库中
+	id, err := s.store.InsertLottery(game.Code(), issueCode, record)
 	if err != nil {
-		fmt.Println("Prepare error:", err)
-		return nil
+		fmt.Println("保存号码失败:", err)
+		http.Error(w, "保存号码失败", http.StatusInternalServerError)
+		return
 	}
-	rows, err := stmt.Query()
+	fmt.Println("新增id:", id, game.Name(), "期号:", issueCode, "注数:", record.Bets, "生成方式:", record.Strategy)
+
+	var bts = []byte(record.Numbers)
+	w.Write(bts)
+}
+
+func (s *server) lotteryHistoryFunc(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		io.WriteString(w, "只允许POST请求")
+		return
+	}
+	game, err := requestGame(r)
 	if err != nil {
-		fmt.Println("query error:", err)
-		return nil
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	defer rows.Close()
 
-	var results []Lotterys
-	for rows.Next() {
-		var item Lotterys
-		err = rows.Scan(&item.Id, &item.Lottery, &item.CreateTime, &item.Code, &item.Date, &item.Red, &item.Blue, &item.MyPrizeGrade)
-		if err != nil {
-			fmt.Println("Scan error:", err)
-			continue
-		}
+	results, err := s.store.ListLotterys(game.Code())
+	if err != nil {
+		fmt.Println("查询历史记录失败:", err)
+		http.Error(w, "查询历史记录失败", http.StatusInternalServerError)
+		return
+	}
 
-		if item.Red.Valid {
-			item.Red.String = strings.Replace(item.Red.String, ",", " ", -1)
-		}
-		if item.CreateTime.Valid {
-			item.CreateTimeStr = item.CreateTime.Time.Format("2006-01-02 15:04:05")
-		}
-		results = append(results, item)
+	bts, err := json.Marshal(results)
+	if err != nil {
+		io.WriteString(w, "序列化查询结果失败")
+		return
 	}
-	return results
+	io.WriteString(w, string(bts))
 }
 
-func getRecordWithPage(page string, pagecount string) []Lotterys {
-	absDir, err := os.Getwd()
-	if err != nil {
-		fmt.Println("获取程序工作目录失败，错误描述：" + err.Error())
-		return nil
+func (s *server) lotteryHistoryFuncWithPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		io.WriteString(w, "只允许POST请求")
+		return
 	}
-	db, err := sql.Open("sqlite3", absDir+"/serverDB.db")
+
+	game, err := requestGame(r)
 	if err != nil {
-		fmt.Printf("sqlite open failed:[%v]", err.Error())
-		return nil
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	defer db.Close()
+	page := r.Form.Get("page")
+	pagecount := r.Form.Get("pagecount")
+	//fmt.Printf("page: %s pagecount: %s\n", page, pagecount)
 
-	querySql := "select id, lottery, create_time,code, date, red, blue, my_prize_grade from lottery order by create_time desc;"
+	var results []Lotterys
 	if len(page) > 0 && len(pagecount) > 0 {
-		pagenum, err := strconv.Atoi(page)
-		if err != nil {
-			fmt.Println("将page转为int错误:", err)
-			return nil
+		pagenum, perr := strconv.Atoi(page)
+		if perr != nil {
+			http.Error(w, "page参数错误", http.StatusBadRequest)
+			return
 		}
-		pagecountnum, err := strconv.Atoi(pagecount)
-		if err != nil {
-			fmt.Println("将pagecount转为int错误:", err)
-			return nil
-		}
-		if pagenum > 0 {
-			pagenum = pagenum - 1
+		pagecountnum, perr := strconv.Atoi(pagecount)
+		if perr != nil {
+			http.Error(w, "pagecount参数错误", http.StatusBadRequest)
+			return
 		}
-		offset := pagenum * pagecountnum
-		querySql = fmt.Sprintf("select id, lottery, create_time,code, date, red, blue, my_prize_grade from lottery order by create_time desc LIMIT %d OFFSET %d;", pagecountnum, offset)
-	}
-	//fmt.Println("querySql:", querySql)
-	stmt, err := db.Prepare(querySql)
-	if err != nil {
-		fmt.Println("Prepare error:", err)
-		return nil
+		results, err = s.store.ListLotterysWithPage(game.Code(), pagenum, pagecountnum)
+	} else {
+		results, err = s.store.ListLotterys(game.Code())
 	}
-	rows, err := stmt.Query()
 	if err != nil {
-		fmt.Println("query error:", err)
-		return nil
+		fmt.Println("查询历史记录失败:", err)
+		http.Error(w, "查询历史记录失败", http.StatusInternalServerError)
+		return
 	}
-	defer rows.Close()
-
-	var results []Lotterys
-	for rows.Next() {
-		var item Lotterys
-		err = rows.Scan(&item.Id, &item.Lottery, &item.CreateTime, &item.Code, &item.Date, &item.Red, &item.Blue, &item.MyPrizeGrade)
-		if err != nil {
-			fmt.Println("Scan error:", err)
-			continue
-		}
 
-		if item.Red.Valid {
-			item.Red.String = strings.Replace(item.Red.String, ",", " ", -1)
-		}
-		if item.CreateTime.Valid {
-			item.CreateTimeStr = item.CreateTime.Time.Format("2006-01-02 15:04:05")
-		}
-		results = append(results, item)
+	bts, err := json.Marshal(results)
+	if err != nil {
+		io.WriteString(w, "序列化查询结果失败")
+		return
 	}
-	return results
+	io.WriteString(w, string(bts))
 }
 
-func queryKjggImpl(w http.ResponseWriter, r *http.Request) {
+// queryKjggImpl 立即查询开奖公告，带 game 参数时只查询该玩法
+func (s *server) queryKjggImpl(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		io.WriteString(w, "只允许GET请求")
 		return
 	}
 
-	go queryKjgg()
+	r.ParseForm()
+	if code := r.Form.Get("game"); code != "" {
+		game, err := gameByCode(code)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		go s.queryGameKjgg(game)
+	} else {
+		go s.queryKjgg()
+	}
 
 	io.WriteString(w, "success")
 }
 
-func queryKjgg() {
-	fmt.Println("queryKjgg")
-	client := &http.Client{Timeout: 10 * time.Second}
+// queryKjgg 依次查询所有玩法的开奖公告
+func (s *server) queryKjgg() {
+	for _, game := range allGames() {
+		s.queryGameKjgg(game)
+	}
+}
 
-	req, err := http.NewRequest("GET", kjggUrl, nil)
+func (s *server) queryGameKjgg(game Game) {
+	fmt.Println("queryKjgg", game.Code())
+	items, err := s.sources[game.Code()].Latest(30)
 	if err != nil {
+		fmt.Println("查询", game.Name(), "开奖公告失败:", err)
 		return
 	}
-	req.Header.Add("Referer", "http://www.cwl.gov.cn/ygkj/kjgg/")
-	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/97.0.4692.99 Safari/537.36")
-	req.Header.Add("X-Requested-With", "XMLHttpRequest")
-	req.Header.Add("Accept", "application/json, text/javascript, */*; q=0.01")
-	req.Header.Add("Host", "www.cwl.gov.cn")
-	req.Header.Add("Cookie", "_ga=GA1.3.1940681231.1595247885; HMF_CI=a9decaf585b61e962b2d7563d6120430c8baebe64c03b6b525f7807d8433cad4e4; 21_vq=15")
 
-	resp, err := client.Do(req)
+	//每一期开奖结果都按期号入库，不论这期有没有人生成号码
+	saved, err := saveKjggItems(s.store, game, items)
 	if err != nil {
+		fmt.Println("保存", game.Name(), "开奖结果失败:", err)
 		return
 	}
-	defer resp.Body.Close()
-
-	result, _ := ioutil.ReadAll(resp.Body)
+	fmt.Println(game.Name(), "已保存开奖结果期数:", saved)
 
-	var kjggData KjggData
-	err = json.Unmarshal(result, &kjggData)
+	//新的开奖号码加入模型，之后生成的号码使用最新的训练数据
+	added, err := s.models.Refresh(s.store, game)
 	if err != nil {
-		fmt.Println("结构化开奖公告结果发生错误:", err)
-		return
-	}
-	for i := 0; i < len(kjggData.Result); i++ {
-		//开奖日期
-		kjDate := kjggData.Result[i].Date[:strings.Index(kjggData.Result[i].Date, "(")]
-		fullKjDate := kjDate + " 21:30:00"
-		if (i + 1) < len(kjggData.Result) {
-			prevDate := kjggData.Result[i+1].Date[:strings.Index(kjggData.Result[i+1].Date, "(")]
-			fullPrevDate := prevDate + " 21:30:00"
-			results := getLotteryRecord(fullPrevDate, fullKjDate)
-			for j := 0; j < len(results); j++ {
-				item := results[j]
-				item.Code = sql.NullString{kjggData.Result[i].Code, true}
-				item.DetailsLink = kjggData.Result[i].DetailsLink
-				item.VideoLink = kjggData.Result[i].VideoLink
-				item.Date = sql.NullString{kjggData.Result[i].Date, true}
-				item.Week = kjggData.Result[i].Week
-				item.Red = sql.NullString{kjggData.Result[i].Red, true}
-				item.Blue = sql.NullString{kjggData.Result[i].Blue, true}
-				item.Sales = kjggData.Result[i].Sales
-				item.PoolMoney = kjggData.Result[i].PoolMoney
-				item.Content = kjggData.Result[i].Content
-				redCount, blueCount, prizeGrade := calcMyPrizeGrade(item.Lottery, kjggData.Result[i].Red, kjggData.Result[i].Blue)
-				item.MyPrizeGrade = sql.NullInt32{int32(prizeGrade), true}
-				item.RedCount = sql.NullInt32{int32(redCount), true}
-				item.BlueCount = sql.NullInt32{int32(blueCount), true}
-				updateMyRecord(item)
-			}
-		}
+		fmt.Println("更新", game.Name(), "模型失败:", err)
+	} else if added > 0 {
+		fmt.Println(game.Name(), "模型新增训练数据期数:", added)
 	}
+
+	s.gradeTickets()
 }
 
-// 根据日期查询居于两个开奖公告之间的号码记录 并用于后续更新开奖结果到数据库中
-func getLotteryRecord(startDate string, endDate string) []Lotterys {
-	absDir, err := os.Getwd()
-	if err != nil {
-		fmt.Println("获取程序工作目录失败，错误描述：" + err.Error())
-		return nil
-	}
-	db, err := sql.Open("sqlite3", absDir+"/serverDB.db")
+// gradeTickets 用 draws 表中的开奖结果计算所有待开奖号码的奖级
+func (s *server) gradeTickets() {
+	pending, err := s.store.PendingTickets()
 	if err != nil {
-		fmt.Printf("sqlite open failed:[%v]", err.Error())
-		return nil
+		fmt.Println("查询待开奖号码失败:", err)
+		return
 	}
-	defer db.Close()
-
-	querySql := `select id, lottery from lottery where my_prize_grade is null and create_time between ? and ? order by create_time desc;`
+	s.saveGrades(pending)
+}
 
-	stmt, err := db.Prepare(querySql)
+// regradeTickets 按各期当时生效的规则重新计算所有已开奖号码的奖级和奖金
+func (s *server) regradeTickets() error {
+	graded, err := s.store.GradedTickets()
 	if err != nil {
-		fmt.Println("Prepare error:", err)
-		return nil
+		return err
 	}
-	rows, err := stmt.Query(startDate, endDate)
+	pending, err := s.store.PendingTickets()
 	if err != nil {
-		fmt.Println("query error:", err)
-		return nil
+		return err
 	}
-	defer rows.Close()
-
-	var results []Lotterys
-	for rows.Next() {
-		var item Lotterys
-		err = rows.Scan(&item.Id, &item.Lottery)
-		if err != nil {
-			fmt.Println("Scan error:", err)
-			continue
-		}
-
-		results = append(results, item)
-	}
-	return results
+	s.saveGrades(append(graded, pending...))
+	return nil
 }
 
-// 根据开奖结果计算号码是几等奖 返回：红球匹配数量 篮球匹配数量 几等奖
-func calcMyPrizeGrade(myCode string, red string, blue string) (int, int, int) {
-	myNumbers := strings.Split(myCode, " ") //红蓝一起 最后一个是蓝球
-	redBalls := strings.Split(red, ",")     //开奖红球数组
-	redCount := 0
-	prizeGrade := 7
-	for i := 0; i < 6; i++ {
-		myRedBall, err := strconv.Atoi(myNumbers[i])
+func (s *server) saveGrades(tickets []PendingTicket) {
+	draws := make(map[string]Draw)
+	for _, ticket := range tickets {
+		game, err := gameByCode(ticket.Game)
 		if err != nil {
-			fmt.Println("将号码转为int错误:", err)
+			fmt.Println("Id:", ticket.TicketId, err)
 			continue
 		}
-		for j := 0; j < 6; j++ {
-			theirRedBall, err := strconv.Atoi(redBalls[j])
+		key := ticket.Game + ":" + ticket.DrawCode
+		draw, ok := draws[key]
+		if !ok {
+			draw, err = s.store.GetDraw(ticket.Game, ticket.DrawCode)
 			if err != nil {
-				fmt.Println("将号码转为int错误2:", err)
+				fmt.Println("查询", game.Name(), "第", ticket.DrawCode, "期开奖结果失败:", err)
 				continue
 			}
-			if myRedBall == theirRedBall {
-				redCount++
-				break
-			}
+			draws[key] = draw
 		}
-	}
 
-	myBlueBall, err := strconv.Atoi(myNumbers[6])
-	if err != nil {
-		fmt.Println("将我的蓝球转为int时错误:", err)
-		return redCount, 0, prizeGrade
-	}
-	theirBlueBall, err := strconv.Atoi(blue)
-	if err != nil {
-		fmt.Println("将结果蓝球转为int时错误:", err)
-		return redCount, 0, prizeGrade
-	}
-	blueFlag := false
-	if myBlueBall == theirBlueBall {
-		blueFlag = true
-	}
-
-	//根据红球 蓝球数量计算双色球属于几等奖
-	if redCount == 6 {
-		if blueFlag {
-			prizeGrade = 1
-		} else {
-			prizeGrade = 2
-		}
-	} else if redCount == 5 {
-		if blueFlag {
-			prizeGrade = 3
-		} else {
-			prizeGrade = 4
-		}
-	} else if redCount == 4 {
-		if blueFlag {
-			prizeGrade = 4
-		} else {
-			prizeGrade = 5
+		result, err := gradeTicket(game, ticket, draw)
+		if err != nil {
+			fmt.Println("Id:", ticket.TicketId, "计奖失败:", err)
+			continue
 		}
-	} else if redCount <= 3 {
-		if blueFlag && redCount == 3 {
-			prizeGrade = 5
-		} else if blueFlag {
-			prizeGrade = 6
-		} else {
-			prizeGrade = 7
+		fmt.Println("Id:", ticket.TicketId, " 号码", ticket.Numbers, " ", result.PrizeGrade, " 等奖")
+		if err = s.store.SaveTicketResult(result); err != nil {
+			fmt.Println("执行更新出错:", err)
+			continue
 		}
+		fmt.Println("更新id:", ticket.TicketId, "成功")
 	}
-	blueCount := 0
-	if blueFlag {
-		blueCount = 1
-	}
-	return redCount, blueCount, prizeGrade
 }
 
-func updateMyRecord(item Lotterys) {
-	fmt.Println("Id:", item.Id, " 号码", item.Lottery, " ", item.MyPrizeGrade, " 等奖")
-	absDir, err := os.Getwd()
+// gradeTicket 按开奖当期生效的规则计算一注号码的奖级和奖金
+// 号码或开奖号码格式错误时返回错误，不记为未中奖，号码保持待计奖
+func gradeTicket(game Game, ticket PendingTicket, draw Draw) (TicketResult, error) {
+	mine, err := ticket.Ticket()
 	if err != nil {
-		fmt.Println("获取程序工作目录失败，错误描述：" + err.Error())
-		return
+		return TicketResult{}, fmt.Errorf("号码格式错误: %w", err)
 	}
-	db, err := sql.Open("sqlite3", absDir+"/serverDB.db")
+	drawn, err := game.DrawNumbers(draw)
 	if err != nil {
-		fmt.Printf("sqlite open failed:[%v]", err.Error())
-		return
+		return TicketResult{}, fmt.Errorf("开奖号码格式错误: %w", err)
 	}
-	defer db.Close()
 
-	updateStr := `update lottery set code=?,details_link=?,video_link=?,date=?,week=?,red=?,blue=?,
-		sales=?,pool_money=?,content=?,my_prize_grade=?,red_count=?,blue_count=? where id=?;`
-	stmt, err := db.Prepare(updateStr)
-	if err != nil {
-		fmt.Println("prepare update sql:", updateStr, " 错误:", err)
-		return
+	result := gradeNumbers(game, mine, drawn, draw)
+	result.TicketId = ticket.TicketId
+	return result, nil
+}
+
+// gradeNumbers 用已解析的开奖号码计算一注号码的奖级和奖金，复式、胆拖号码展开后逐注计奖
+func gradeNumbers(game Game, mine Ticket, drawn Ticket, draw Draw) TicketResult {
+	rules := game.RuleSetFor(draw.Code, draw.DrawDate)
+	result := TicketResult{
+		DrawCode:   draw.Code,
+		PrizeGrade: noPrize,
+		RuleSet:    rules.Name,
 	}
 
-	ret, err := stmt.Exec(item.Code, item.DetailsLink, item.VideoLink, item.Date, item.Week, item.Red, item.Blue,
-		item.Sales, item.PoolMoney, item.Content, item.MyPrizeGrade, item.RedCount, item.BlueCount, item.Id)
-	if err != nil {
-		fmt.Println("执行更新出错:", err)
-		return
+	//各区命中数量按整注号码统计，胆码计入第一个区
+	hits, _ := game.Grade(mine.withoutBankers(), drawn, rules)
+	result.RedCount = hits[0]
+	if len(hits) > 1 {
+		result.BlueCount = hits[1]
 	}
 
-	_, err = ret.RowsAffected()
-	if err != nil {
-		fmt.Println("更新ID:", item.Id, " 失败")
-		return
+	//复式号码展开为单式逐注计奖，记录最高奖级以及各奖级的注数和奖金
+	counts := make(map[int]int)
+	for _, single := range expandTicket(game, mine) {
+		if _, grade := game.Grade(single, drawn, rules); grade != noPrize {
+			counts[grade]++
+		}
 	}
-	fmt.Println("更新id:", item.Id, "成功")
+	var grades []int
+	for grade := range counts {
+		grades = append(grades, grade)
+	}
+	sort.Ints(grades)
+	for _, grade := range grades {
+		money := calcPrizeMoney(rules, mine.Play, grade, draw) * int64(counts[grade])
+		result.Tiers = append(result.Tiers, TierResult{PrizeGrade: grade, BetCount: counts[grade], PrizeMoney: money})
+		result.PrizeMoney += money
+	}
+	if len(grades) > 0 {
+		result.PrizeGrade = grades[0]
+	}
+	return result
 }
 
-func loadDataImpl(w http.ResponseWriter, r *http.Request) {
+func (s *server) loadDataImpl(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		io.WriteString(w, "只允许POST请求")
 		return
 	}
-
-	results := getDatas()
-
-	bts, err := json.Marshal(results)
-	//fmt.Printf("loadData:[%v]\n", string(bts))
+	game, err := requestGame(r)
 	if err != nil {
-		io.WriteString(w, "序列化查询结果失败")
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	io.WriteString(w, string(bts))
-}
 
-func getDatas() []LotteryDatas {
-	absDir, err := os.Getwd()
-	if err != nil {
-		fmt.Println("获取程序工作目录失败，错误描述：" + err.Error())
-		return nil
-	}
-	db, err := sql.Open("sqlite3", absDir+"/serverDB.db")
+	results, err := s.store.LoadDatas(game.Code())
 	if err != nil {
-		fmt.Printf("sqlite open failed:[%v]", err.Error())
-		return nil
+		fmt.Println("汇总数据失败:", err)
+		http.Error(w, "汇总数据失败", http.StatusInternalServerError)
+		return
 	}
-	defer db.Close()
 
-	//querySql := "select count(1) as totalcount from lottery order by create_time desc;"
-	querySql := `select count(1) as totalcount, (select count(1) from lottery where my_prize_grade=1) as firstcount,
-		(select count(1) from lottery where my_prize_grade=2) as secondcount,
-		(select count(1) from lottery where my_prize_grade=3) as thirdcount,
-		(select count(1) from lottery where my_prize_grade=4) as forthcount,
-		(select count(1) from lottery where my_prize_grade=5) as fifthcount,
-		(select count(1) from lottery where my_prize_grade=6) as sixthcount 
-		 from lottery`
-	stmt, err := db.Prepare(querySql)
-	if err != nil {
-		fmt.Println("Prepare error:", err)
-		return nil
-	}
-	rows, err := stmt.Query()
+	bts, err := json.Marshal(results)
+	//fmt.Printf("loadData:[%v]\n", string(bts))
 	if err != nil {
-		fmt.Println("query error:", err)
-		return nil
-	}
-	defer rows.Close()
-
-	var results []LotteryDatas
-	for rows.Next() {
-		var item LotteryDatas
-		err = rows.Scan(&item.TotalCount, &item.FirstCount, &item.SecondCount, &item.ThirdCount, &item.ForthCount,
-			&item.FifthCount, &item.SixthCount)
-		if err != nil {
-			fmt.Println("Scan error:", err)
-			return nil
-		}
-		results = append(results, item)
+		io.WriteString(w, "序列化查询结果失败")
+		return
 	}
-	return results
+	io.WriteString(w, string(bts))
 }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// markovConfig 马尔可夫链生成方式的参数
+// order=1、positional=0、smoothing=0 即原来的一阶链：所有位置共用一张转移表，从状态 0 出发
+type markovConfig struct {
+	Order      int     // 阶数，1 或 2；二阶链遇到没见过的状态时退回一阶
+	Positional bool    // 每个位置单独一张转移表（第1位→第2位、第2位→第3位……）
+	Smoothing  float64 // 拉普拉斯平滑，每个转移的次数都加上该值，没出现过的转移也有可能被选中
+	Blue       bool    // 其余的区以上一期该区的号码为条件，否则按整体出现频率
+}
+
+// markovDefaults 马尔可夫链生成方式的默认参数
+var markovDefaults = map[string]int{"order": 1, "positional": 0, "smoothing": 0, "blue": 1}
+
+func newMarkovConfig(params map[string]int) (markovConfig, error) {
+	value := func(name string) int {
+		if v, ok := params[name]; ok {
+			return v
+		}
+		return markovDefaults[name]
+	}
+	config := markovConfig{
+		Order:      value("order"),
+		Positional: value("positional") == 1,
+		Smoothing:  float64(value("smoothing")),
+		Blue:       value("blue") == 1,
+	}
+	if config.Order < 1 || config.Order > 2 {
+		return config, fmt.Errorf("马尔可夫链的阶数应为1或2")
+	}
+	if value("positional") > 1 || value("blue") > 1 {
+		return config, fmt.Errorf("positional、blue 参数应为0或1")
+	}
+	return config, nil
+}
+
+// legacy 是否是原来的一阶链
+func (c markovConfig) legacy() bool {
+	return c.Order == 1 && !c.Positional && c.Smoothing == 0
+}
+
+// markovState 转移表的状态：位置（不区分位置时为 -1）和前一个、前两个号码，0 表示还没有号码
+type markovState struct {
+	slot  int
+	prev1 int
+	prev2 int
+}
+
+// markovChain 第一个区按号码从小到大的顺序构成的转移次数表
+type markovChain struct {
+	config markovConfig
+	counts map[markovState]map[int]float64
+}
+
+func newMarkovChain(config markovConfig) *markovChain {
+	return &markovChain{config: config, counts: make(map[markovState]map[int]float64)}
+}
+
+// add 统计一期第一个区相邻号码的转移次数；二阶链同时统计一阶的次数用于退回
+func (c *markovChain) add(draw Ticket) {
+	if len(draw.Zones) == 0 {
+		return
+	}
+	numbers := draw.Zones[0]
+	for i, next := range numbers {
+		for order := 1; order <= c.config.Order; order++ {
+			state := c.state(numbers[:i], order)
+			if c.counts[state] == nil {
+				c.counts[state] = make(map[int]float64)
+			}
+			c.counts[state][next]++
+		}
+	}
+}
+
+// transition 一阶链的转移次数表：前一个号码（0 为起始状态）-> 下一个号码 -> 次数，
+// 可直接作为 generateRedNumbers 的转移概率表（选号时会归一化）
+func (c *markovChain) transition() map[int]map[int]float64 {
+	transition := make(map[int]map[int]float64)
+	for state, counts := range c.counts {
+		if state.slot == -1 && state.prev2 == -1 {
+			transition[state.prev1] = counts
+		}
+	}
+	return transition
+}
+
+// state 已选号码 selected 之后的状态
+func (c *markovChain) state(selected []int, order int) markovState {
+	state := markovState{slot: -1}
+	if c.config.Positional {
+		state.slot = len(selected)
+	}
+	if n := len(selected); n >= 1 {
+		state.prev1 = selected[n-1]
+		if order >= 2 && n >= 2 {
+			state.prev2 = selected[n-2]
+		}
+	}
+	if order < 2 {
+		//一阶的状态和前两个号码无关
+		state.prev2 = -1
+	}
+	return state
+}
+
+// generate 从 fixed（胆码、指定的拖码）之后继续按转移概率补足到 zone.Pick 个不重复的号码
+func (c *markovChain) generate(zone Zone, fixed []int, exclude []int, r *rand.Rand) []int {
+	result := append([]int(nil), fixed...)
+	selected := make(map[int]bool)
+	for _, n := range append(append([]int(nil), fixed...), exclude...) {
+		selected[n] = true
+	}
+	for len(result) < zone.Pick {
+		var next int
+		ok := false
+		for order := c.config.Order; order >= 1 && !ok; order-- {
+			next, ok = c.pick(c.counts[c.state(result, order)], zone, selected, r)
+		}
+		if !ok {
+			next = randomUnselected(selected, zone, r)
+		}
+		result = append(result, next)
+		selected[next] = true
+	}
+	return result
+}
+
+// pick 按转移次数加平滑值选一个未选过的号码，全部为 0 时返回 false
+func (c *markovChain) pick(counts map[int]float64, zone Zone, selected map[int]bool, r *rand.Rand) (int, bool) {
+	total := 0.0
+	for n := zone.Min; n <= zone.Max; n++ {
+		if !selected[n] {
+			total += counts[n] + c.config.Smoothing
+		}
+	}
+	if total == 0 {
+		return 0, false
+	}
+	x := r.Float64() * total
+	last := 0
+	for n := zone.Min; n <= zone.Max; n++ {
+		weight := counts[n] + c.config.Smoothing
+		if selected[n] || weight == 0 {
+			continue
+		}
+		last = n
+		if x -= weight; x < 0 {
+			return n, true
+		}
+	}
+	return last, true
+}
@@ -0,0 +1,615 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migration 是一次只进不退的表结构变更，version 必须严格递增
+type migration struct {
+	version     int
+	description string
+	up          func(tx *sql.Tx) error
+}
+
+// execStatements 依次执行多条 SQL，供只包含 DDL/DML 的迁移使用
+func execStatements(stmts ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// migrations 按版本号从小到大排列，新增迁移只能追加在末尾，已发布的迁移不要再修改
+var migrations = []migration{
+	{
+		version:     1,
+		description: "初始 lottery 表（生成号码和开奖结果混在同一行）",
+		up: execStatements(`CREATE TABLE IF NOT EXISTS "lottery" (
+		"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+		"lottery" varchar(32) NULL,
+		"create_time" TIMESTAMP default (datetime('now', 'localtime')),
+		"code" varchar(8) NULL,
+		"details_link" varchar(64) NULL,
+		"video_link" varchar(64) NULL,
+		"date" varchar(32) NULL,
+		"week" varchar(8) NULL,
+		"red" varchar(16) NULL,
+		"blue" varchar(8) NULL,
+		"sales" varchar(16) NULL,
+		"pool_money" varchar(16) NULL,
+		"content" varchar(255) NULL,
+		"my_prize_grade" tinyint(2) NULL,
+		"red_count" tinyint(2) NULL,
+		"blue_count" tinyint(2) NULL
+	  );`),
+	},
+	{
+		version:     2,
+		description: "拆分为 draws、tickets、ticket_results 三张表并迁移 lottery 中的数据",
+		up: execStatements(
+			// 开奖结果，每期一行。red/blue 为两位数、逗号分隔的号码
+			`CREATE TABLE "draws" (
+				"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+				"code" TEXT NOT NULL UNIQUE,
+				"draw_date" TEXT NULL,
+				"week" TEXT NULL,
+				"red" TEXT NOT NULL,
+				"blue" TEXT NOT NULL,
+				"sales" INTEGER NULL,
+				"pool_money" INTEGER NULL,
+				"details_link" TEXT NULL,
+				"video_link" TEXT NULL,
+				"content" TEXT NULL,
+				"create_time" TIMESTAMP NOT NULL default (datetime('now', 'localtime'))
+			);`,
+			// 生成的号码，numbers 为空格分隔，最后一个是蓝球
+			`CREATE TABLE "tickets" (
+				"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+				"numbers" TEXT NOT NULL,
+				"create_time" TIMESTAMP NOT NULL default (datetime('now', 'localtime'))
+			);`,
+			`CREATE INDEX "idx_tickets_create_time" ON "tickets" ("create_time");`,
+			// 号码对应某一期的中奖情况，每个号码最多一行
+			`CREATE TABLE "ticket_results" (
+				"ticket_id" INTEGER PRIMARY KEY REFERENCES "tickets" ("id"),
+				"draw_code" TEXT NOT NULL REFERENCES "draws" ("code"),
+				"red_count" INTEGER NOT NULL,
+				"blue_count" INTEGER NOT NULL,
+				"prize_grade" INTEGER NOT NULL,
+				"graded_at" TIMESTAMP NOT NULL default (datetime('now', 'localtime'))
+			);`,
+			`CREATE INDEX "idx_ticket_results_draw_code" ON "ticket_results" ("draw_code");`,
+			// 旧库中同一期的开奖结果会在多行重复出现，按期号只保留一份
+			`INSERT INTO "draws" ("code", "draw_date", "week", "red", "blue", "sales", "pool_money", "details_link", "video_link", "content")
+				SELECT "code", substr("date", 1, 10), "week", "red", "blue",
+					CAST(NULLIF("sales", '') AS INTEGER), CAST(NULLIF("pool_money", '') AS INTEGER),
+					"details_link", "video_link", "content"
+				FROM "lottery"
+				WHERE "code" IS NOT NULL AND "red" IS NOT NULL AND "blue" IS NOT NULL
+				GROUP BY "code"
+				ORDER BY "code";`,
+			// 保留原有 id，已发给用户的序号不变
+			`INSERT INTO "tickets" ("id", "numbers", "create_time")
+				SELECT "id", COALESCE("lottery", ''), COALESCE("create_time", datetime('now', 'localtime'))
+				FROM "lottery"
+				ORDER BY "id";`,
+			`INSERT INTO "ticket_results" ("ticket_id", "draw_code", "red_count", "blue_count", "prize_grade")
+				SELECT "id", "code", COALESCE("red_count", 0), COALESCE("blue_count", 0), "my_prize_grade"
+				FROM "lottery"
+				WHERE "my_prize_grade" IS NOT NULL AND "code" IN (SELECT "code" FROM "draws");`,
+			// 原表改名保留，便于核对迁移结果，程序不再读写它
+			`ALTER TABLE "lottery" RENAME TO "lottery_legacy";`,
+		),
+	},
+	{
+		version:     3,
+		description: "draws 表补充公告中的派奖字段，新增 draw_prize_grades 表保存各奖级中奖注数和金额",
+		up: execStatements(
+			`ALTER TABLE "draws" ADD COLUMN "add_money" TEXT NULL;`,
+			`ALTER TABLE "draws" ADD COLUMN "add_money2" TEXT NULL;`,
+			`ALTER TABLE "draws" ADD COLUMN "zj1" TEXT NULL;`,
+			`ALTER TABLE "draws" ADD COLUMN "mj1" TEXT NULL;`,
+			`ALTER TABLE "draws" ADD COLUMN "zj6" TEXT NULL;`,
+			`ALTER TABLE "draws" ADD COLUMN "mj6" TEXT NULL;`,
+			`ALTER TABLE "draws" ADD COLUMN "z2add" TEXT NULL;`,
+			`ALTER TABLE "draws" ADD COLUMN "m2add" TEXT NULL;`,
+			`ALTER TABLE "draws" ADD COLUMN "msg" TEXT NULL;`,
+			`ALTER TABLE "draws" ADD COLUMN "update_time" TIMESTAMP NULL;`,
+			// type_num/type_money 在公告里可能是空串或 "---"，无法解析时存 NULL
+			`CREATE TABLE "draw_prize_grades" (
+				"draw_code" TEXT NOT NULL REFERENCES "draws" ("code") ON DELETE CASCADE,
+				"type" INTEGER NOT NULL,
+				"type_num" INTEGER NULL,
+				"type_money" INTEGER NULL,
+				PRIMARY KEY ("draw_code", "type")
+			);`,
+		),
+	},
+	{
+		version:     4,
+		description: "tickets 表记录号码参与的期号，计奖按期号关联开奖结果",
+		up: execStatements(
+			`ALTER TABLE "tickets" ADD COLUMN "issue_code" TEXT NULL;`,
+			`CREATE INDEX "idx_tickets_issue_code" ON "tickets" ("issue_code");`,
+			`UPDATE "tickets" SET "issue_code" = (SELECT "draw_code" FROM "ticket_results" r WHERE r."ticket_id" = "tickets"."id")
+				WHERE "issue_code" IS NULL;`,
+			// 未计奖的旧号码按开奖日 20:00 停售归到对应的一期，还没有开奖结果的留空，计奖时再按同样规则匹配
+			`UPDATE "tickets" SET "issue_code" = (SELECT d."code" FROM "draws" d WHERE d."draw_date" || ' 20:00:00' > "tickets"."create_time"
+				ORDER BY d."draw_date" LIMIT 1)
+				WHERE "issue_code" IS NULL;`,
+		),
+	},
+	{
+		version:     5,
+		description: "ticket_results 记录单注奖金（分）",
+		up: execStatements(
+			`ALTER TABLE "ticket_results" ADD COLUMN "prize_money" INTEGER NOT NULL DEFAULT 0;`,
+			// 已计奖的号码：固定奖级按官方奖金，一、二等奖取当期公告的单注奖金
+			`UPDATE "ticket_results" SET "prize_money" = CASE "prize_grade"
+				WHEN 3 THEN 300000
+				WHEN 4 THEN 20000
+				WHEN 5 THEN 1000
+				WHEN 6 THEN 500
+				WHEN 1 THEN COALESCE((SELECT g."type_money" * 100 FROM "draw_prize_grades" g
+					WHERE g."draw_code" = "ticket_results"."draw_code" AND g."type" = 1), 0)
+				WHEN 2 THEN COALESCE((SELECT g."type_money" * 100 FROM "draw_prize_grades" g
+					WHERE g."draw_code" = "ticket_results"."draw_code" AND g."type" = 2), 0)
+				ELSE 0 END;`,
+		),
+	},
+	{
+		version:     6,
+		description: "未中奖由 7 改为 0（7 留给福运奖），ticket_results 记录计奖规则",
+		up: execStatements(
+			`ALTER TABLE "ticket_results" ADD COLUMN "rule_set" TEXT NULL;`,
+			// 此前的结果都按最初的规则计算，其中 7 表示未中奖
+			`UPDATE "ticket_results" SET "prize_grade" = 0, "rule_set" = 'ssq-2003' WHERE "prize_grade" = 7;`,
+			`UPDATE "ticket_results" SET "rule_set" = 'ssq-2003' WHERE "rule_set" IS NULL;`,
+		),
+	},
+	{
+		version:     7,
+		description: "支持多种玩法：draws、draw_prize_grades、tickets 增加 game 字段，期号按玩法唯一",
+		up: execStatements(
+			// sqlite 不能修改唯一约束，重建 draws；已有数据都是双色球
+			`CREATE TABLE "draws_v7" (
+				"id" INTEGER PRIMARY KEY AUTOINCREMENT,
+				"game" TEXT NOT NULL DEFAULT 'ssq',
+				"code" TEXT NOT NULL,
+				"draw_date" TEXT NULL,
+				"week" TEXT NULL,
+				"red" TEXT NOT NULL,
+				"blue" TEXT NOT NULL,
+				"sales" INTEGER NULL,
+				"pool_money" INTEGER NULL,
+				"details_link" TEXT NULL,
+				"video_link" TEXT NULL,
+				"content" TEXT NULL,
+				"create_time" TIMESTAMP NOT NULL default (datetime('now', 'localtime')),
+				"add_money" TEXT NULL,
+				"add_money2" TEXT NULL,
+				"zj1" TEXT NULL,
+				"mj1" TEXT NULL,
+				"zj6" TEXT NULL,
+				"mj6" TEXT NULL,
+				"z2add" TEXT NULL,
+				"m2add" TEXT NULL,
+				"msg" TEXT NULL,
+				"update_time" TIMESTAMP NULL,
+				UNIQUE ("game", "code")
+			);`,
+			`INSERT INTO "draws_v7" ("id", "game", "code", "draw_date", "week", "red", "blue", "sales", "pool_money", "details_link",
+				"video_link", "content", "create_time", "add_money", "add_money2", "zj1", "mj1", "zj6", "mj6", "z2add", "m2add", "msg", "update_time")
+				SELECT "id", 'ssq', "code", "draw_date", "week", "red", "blue", "sales", "pool_money", "details_link",
+				"video_link", "content", "create_time", "add_money", "add_money2", "zj1", "mj1", "zj6", "mj6", "z2add", "m2add", "msg", "update_time"
+				FROM "draws";`,
+			// 引用 draws 的两张表先把数据放到临时表，删掉旧表后按新的外键重建
+			`CREATE TEMP TABLE "ticket_results_v6" AS SELECT * FROM "ticket_results";`,
+			`CREATE TEMP TABLE "draw_prize_grades_v6" AS SELECT * FROM "draw_prize_grades";`,
+			`DROP TABLE "ticket_results";`,
+			`DROP TABLE "draw_prize_grades";`,
+			`DROP TABLE "draws";`,
+			`ALTER TABLE "draws_v7" RENAME TO "draws";`,
+			// 期号只在同一玩法内唯一，ticket_results 通过 tickets.game 和 draw_code 关联开奖结果
+			`CREATE TABLE "ticket_results" (
+				"ticket_id" INTEGER PRIMARY KEY REFERENCES "tickets" ("id"),
+				"draw_code" TEXT NOT NULL,
+				"red_count" INTEGER NOT NULL,
+				"blue_count" INTEGER NOT NULL,
+				"prize_grade" INTEGER NOT NULL,
+				"graded_at" TIMESTAMP NOT NULL default (datetime('now', 'localtime')),
+				"prize_money" INTEGER NOT NULL DEFAULT 0,
+				"rule_set" TEXT NULL
+			);`,
+			`CREATE INDEX "idx_ticket_results_draw_code" ON "ticket_results" ("draw_code");`,
+			`INSERT INTO "ticket_results" ("ticket_id", "draw_code", "red_count", "blue_count", "prize_grade", "graded_at", "prize_money", "rule_set")
+				SELECT "ticket_id", "draw_code", "red_count", "blue_count", "prize_grade", "graded_at", "prize_money", "rule_set"
+				FROM temp."ticket_results_v6";`,
+			`CREATE TABLE "draw_prize_grades" (
+				"game" TEXT NOT NULL DEFAULT 'ssq',
+				"draw_code" TEXT NOT NULL,
+				"type" INTEGER NOT NULL,
+				"type_num" INTEGER NULL,
+				"type_money" INTEGER NULL,
+				PRIMARY KEY ("game", "draw_code", "type"),
+				FOREIGN KEY ("game", "draw_code") REFERENCES "draws" ("game", "code") ON DELETE CASCADE
+			);`,
+			`INSERT INTO "draw_prize_grades" ("game", "draw_code", "type", "type_num", "type_money")
+				SELECT 'ssq', "draw_code", "type", "type_num", "type_money" FROM temp."draw_prize_grades_v6";`,
+			`DROP TABLE temp."ticket_results_v6";`,
+			`DROP TABLE temp."draw_prize_grades_v6";`,
+			`ALTER TABLE "tickets" ADD COLUMN "game" TEXT NOT NULL DEFAULT 'ssq';`,
+			`CREATE INDEX "idx_tickets_game_issue_code" ON "tickets" ("game", "issue_code");`,
+		),
+	},
+	{
+		version:     8,
+		description: "tickets 表记录投注方式（如福彩3D的直选、组三、组六）",
+		up: execStatements(
+			// 只有一种投注方式的玩法为空串
+			`ALTER TABLE "tickets" ADD COLUMN "play" TEXT NOT NULL DEFAULT '';`,
+		),
+	},
+	{
+		version:     9,
+		description: "支持复式号码：tickets 记录单式注数，新增 ticket_result_tiers 表保存各奖级中奖注数",
+		up: execStatements(
+			`ALTER TABLE "tickets" ADD COLUMN "bets" INTEGER NOT NULL DEFAULT 1;`,
+			// 只记录中奖的奖级，prize_money 为该奖级全部注数的奖金之和（分）
+			`CREATE TABLE "ticket_result_tiers" (
+				"ticket_id" INTEGER NOT NULL REFERENCES "tickets" ("id"),
+				"prize_grade" INTEGER NOT NULL,
+				"bet_count" INTEGER NOT NULL,
+				"prize_money" INTEGER NOT NULL,
+				PRIMARY KEY ("ticket_id", "prize_grade")
+			);`,
+			`INSERT INTO "ticket_result_tiers" ("ticket_id", "prize_grade", "bet_count", "prize_money")
+				SELECT "ticket_id", "prize_grade", 1, "prize_money" FROM "ticket_results" WHERE "prize_grade" != 0;`,
+		),
+	},
+	{
+		version:     10,
+		description: "tickets 按胆码、拖码、其余各区分开保存号码（bankers、drags、blues），从 numbers 回填",
+		up: func(tx *sql.Tx) error {
+			err := execStatements(
+				`ALTER TABLE "tickets" ADD COLUMN "bankers" TEXT NOT NULL DEFAULT '';`,
+				`ALTER TABLE "tickets" ADD COLUMN "drags" TEXT NOT NULL DEFAULT '';`,
+				`ALTER TABLE "tickets" ADD COLUMN "blues" TEXT NOT NULL DEFAULT '';`,
+			)(tx)
+			if err != nil {
+				return err
+			}
+			return backfillTicketColumns(tx)
+		},
+	},
+	{
+		version:     11,
+		description: "tickets 记录生成方式和参数，升级前的号码都是马尔可夫链生成",
+		up: execStatements(
+			`ALTER TABLE "tickets" ADD COLUMN "strategy" TEXT NOT NULL DEFAULT 'markov';`,
+			`ALTER TABLE "tickets" ADD COLUMN "params" TEXT NOT NULL DEFAULT '';`,
+			`CREATE INDEX "idx_tickets_game_strategy" ON "tickets" ("game", "strategy");`,
+		),
+	},
+	{
+		version:     12,
+		description: "新增 simulations 表缓存蒙特卡洛模拟结果",
+		up: execStatements(
+			// history_code 为模拟时最新一期的期号，开奖数据更新后不再命中缓存
+			`CREATE TABLE "simulations" (
+				"game" TEXT NOT NULL,
+				"strategy" TEXT NOT NULL,
+				"params" TEXT NOT NULL,
+				"play" TEXT NOT NULL,
+				"tickets" INTEGER NOT NULL,
+				"draws" INTEGER NOT NULL,
+				"seed" INTEGER NOT NULL,
+				"history_code" TEXT NOT NULL,
+				"result" TEXT NOT NULL,
+				"create_time" TIMESTAMP default (datetime('now', 'localtime')),
+				PRIMARY KEY ("game", "strategy", "params", "play", "tickets", "draws", "seed", "history_code")
+			);`,
+		),
+	},
+	{
+		version:     13,
+		description: "tickets 记录随机数种子、种子来源、训练数据最后一期和复式胆拖参数，用于复现号码",
+		up: execStatements(
+			// 升级前的号码 seed 为 NULL，无法复现
+			`ALTER TABLE "tickets" ADD COLUMN "seed" INTEGER NULL;`,
+			`ALTER TABLE "tickets" ADD COLUMN "entropy" TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE "tickets" ADD COLUMN "model_issue" TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE "tickets" ADD COLUMN "request" TEXT NOT NULL DEFAULT '';`,
+		),
+	},
+	{
+		version:     14,
+		description: "新增 server_seeds 表保存各期服务端种子及其承诺，tickets 记录客户端种子和 nonce",
+		up: execStatements(
+			// seed 在该期开奖后才公布，之前只公布 commitment；nonce 为已生成过的种子个数
+			`CREATE TABLE "server_seeds" (
+				"game" TEXT NOT NULL,
+				"issue_code" TEXT NOT NULL,
+				"seed" TEXT NOT NULL,
+				"commitment" TEXT NOT NULL,
+				"nonce" INTEGER NOT NULL DEFAULT 0,
+				"create_time" TIMESTAMP default (datetime('now', 'localtime')),
+				PRIMARY KEY ("game", "issue_code")
+			);`,
+			`ALTER TABLE "tickets" ADD COLUMN "client_seed" TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE "tickets" ADD COLUMN "nonce" INTEGER NULL;`,
+		),
+	},
+	{
+		version:     15,
+		description: "tickets 记录生成时服务端种子的承诺，验证时和开奖后公布的服务端种子核对",
+		up: execStatements(
+			`ALTER TABLE "tickets" ADD COLUMN "commitment" TEXT NOT NULL DEFAULT '';`,
+			// 升级前带 clientSeed 生成的号码用 server_seeds 中现有的承诺补齐
+			`UPDATE "tickets" SET "commitment" = (
+				SELECT "commitment" FROM "server_seeds"
+				WHERE "server_seeds"."game" = "tickets"."game" AND "server_seeds"."issue_code" = "tickets"."issue_code"
+			) WHERE "entropy" = 'hmac' AND EXISTS (
+				SELECT 1 FROM "server_seeds"
+				WHERE "server_seeds"."game" = "tickets"."game" AND "server_seeds"."issue_code" = "tickets"."issue_code"
+			);`,
+		),
+	},
+	{
+		version:     16,
+		description: "新增 skipped_nonces 表记录批量生成时被淘汰、没有保存为号码的 nonce",
+		up: execStatements(
+			`CREATE TABLE "skipped_nonces" (
+				"game" TEXT NOT NULL,
+				"issue_code" TEXT NOT NULL,
+				"nonce" INTEGER NOT NULL,
+				"client_seed" TEXT NOT NULL,
+				"numbers" TEXT NOT NULL,
+				"reason" TEXT NOT NULL,
+				"create_time" TIMESTAMP default (datetime('now', 'localtime')),
+				PRIMARY KEY ("game", "issue_code", "nonce")
+			);`,
+		),
+	},
+}
+
+// backfillTicketColumns 按玩法解析已有号码的 numbers 字符串，写入分开保存的各区号码
+// 无法解析的号码保持为空，计奖时记为未中奖
+func backfillTicketColumns(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT "id", "game", "play", "numbers" FROM "tickets";`)
+	if err != nil {
+		return err
+	}
+	type ticketNumbers struct {
+		id                  int64
+		game, play, numbers string
+	}
+	var tickets []ticketNumbers
+	for rows.Next() {
+		var item ticketNumbers
+		var numbers sql.NullString
+		if err = rows.Scan(&item.id, &item.game, &item.play, &numbers); err != nil {
+			rows.Close()
+			return err
+		}
+		item.numbers = numbers.String
+		tickets = append(tickets, item)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, item := range tickets {
+		bankers, drags, blues, err := migration10Columns(item.game, item.play, item.numbers)
+		if err != nil {
+			fmt.Println("号码", item.id, "格式错误:", err)
+			continue
+		}
+		_, err = tx.Exec(`UPDATE "tickets" SET "bankers" = ?, "drags" = ?, "blues" = ? WHERE "id" = ?;`, bankers, drags, blues, item.id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migration10Zones 迁移 10 发布时各玩法单式号码每个区的个数和号码范围，冻结在迁移里，
+// 之后玩法和号码格式的变化不影响这次迁移；快乐8的个数由投注方式 x1-x10 决定，记为 0
+var migration10Zones = map[string][]struct{ pick, min, max int }{
+	"ssq": {{6, 1, 33}, {1, 1, 16}},
+	"dlt": {{5, 1, 35}, {2, 1, 12}},
+	"3d":  {{1, 0, 9}, {1, 0, 9}, {1, 0, 9}},
+	"qlc": {{7, 1, 30}},
+	"kl8": {{0, 1, 80}},
+}
+
+// migration10Columns 按迁移 10 发布时的号码格式把 numbers 拆成胆码、第一个区和其余各区：
+// 单式号码以空格分隔按各区个数依次切分，复式、胆拖号码以 + 分隔各区、以 # 分隔胆码和拖码；
+// 福彩3D组三、组六的数字按升序保存
+func migration10Columns(game string, play string, numbers string) (bankers string, drags string, blues string, err error) {
+	zones, ok := migration10Zones[game]
+	if !ok {
+		return "", "", "", fmt.Errorf("不支持的玩法: %s", game)
+	}
+	format := func(fields []string, i int) (string, error) {
+		values := make([]int, len(fields))
+		for k, field := range fields {
+			n, err := strconv.Atoi(field)
+			if err != nil || n < zones[i].min || n > zones[i].max {
+				return "", fmt.Errorf("号码 %q 格式错误", numbers)
+			}
+			values[k] = n
+		}
+		if game == "3d" && play != "zx" {
+			sort.Ints(values)
+		}
+		strs := make([]string, len(values))
+		for k, n := range values {
+			strs[k] = fmt.Sprintf("%02d", n)
+		}
+		return strings.Join(strs, ","), nil
+	}
+
+	if strings.ContainsAny(numbers, "+#") {
+		//当时只有双色球、大乐透、七乐彩支持复式、胆拖
+		if game != "ssq" && game != "dlt" && game != "qlc" {
+			return "", "", "", fmt.Errorf("不支持复式号码: %q", numbers)
+		}
+		parts := strings.Split(numbers, "+")
+		if len(parts) != len(zones) {
+			return "", "", "", fmt.Errorf("复式号码 %q 应有%d个区", numbers, len(zones))
+		}
+		first, bankerFields := parts[0], []string(nil)
+		if idx := strings.Index(first, "#"); idx >= 0 {
+			bankerFields, first = strings.Fields(first[:idx]), first[idx+1:]
+		}
+		dragFields := strings.Fields(first)
+		//胆码 1 到 Pick-1 个且胆码拖码合计多于 Pick 个，没有胆码时至少 Pick 个
+		if len(bankerFields) >= zones[0].pick || len(bankerFields)+len(dragFields) < zones[0].pick ||
+			len(bankerFields) > 0 && len(bankerFields)+len(dragFields) == zones[0].pick {
+			return "", "", "", fmt.Errorf("复式号码 %q 个数错误", numbers)
+		}
+		if bankers, err = format(bankerFields, 0); err != nil {
+			return "", "", "", err
+		}
+		if drags, err = format(dragFields, 0); err != nil {
+			return "", "", "", err
+		}
+		var rest []string
+		for i, part := range parts[1:] {
+			fields := strings.Fields(part)
+			if len(fields) < zones[i+1].pick {
+				return "", "", "", fmt.Errorf("复式号码 %q 个数错误", numbers)
+			}
+			zone, err := format(fields, i+1)
+			if err != nil {
+				return "", "", "", err
+			}
+			rest = append(rest, zone)
+		}
+		return bankers, drags, strings.Join(rest, "+"), nil
+	}
+
+	fields := strings.Fields(numbers)
+	if game == "3d" && play != "zx" {
+		//组三、组六三个位置合并排序后再切分
+		if len(fields) != 3 {
+			return "", "", "", fmt.Errorf("号码 %q 数量错误", numbers)
+		}
+		joined, err := format(fields, 0)
+		if err != nil {
+			return "", "", "", err
+		}
+		fields = strings.Split(joined, ",")
+	}
+	var parts []string
+	for i, zone := range zones {
+		pick := zone.pick
+		if pick == 0 {
+			if _, err = fmt.Sscanf(play, "x%d", &pick); err != nil || pick < 1 || pick > 10 {
+				return "", "", "", fmt.Errorf("快乐8投注方式错误: %s", play)
+			}
+		}
+		if len(fields) < pick {
+			return "", "", "", fmt.Errorf("号码 %q 数量不足", numbers)
+		}
+		part, err := format(fields[:pick], i)
+		if err != nil {
+			return "", "", "", err
+		}
+		parts = append(parts, part)
+		fields = fields[pick:]
+	}
+	if len(fields) > 0 {
+		return "", "", "", fmt.Errorf("号码 %q 数量过多", numbers)
+	}
+	return "", parts[0], strings.Join(parts[1:], "+"), nil
+}
+
+// Migrate 将数据库升级到最新版本，返回本次执行（或待执行）的迁移
+// dryRun 为 true 时在同一个事务里执行全部待执行迁移后回滚，只用来检查迁移能否成功
+func (s *LotteryStore) Migrate(dryRun bool) ([]migration, error) {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS "schema_version" (
+		"version" INTEGER PRIMARY KEY,
+		"description" TEXT NOT NULL,
+		"applied_at" TIMESTAMP NOT NULL default (datetime('now', 'localtime'))
+	);`)
+	if err != nil {
+		return nil, fmt.Errorf("创建 schema_version 表失败: %w", err)
+	}
+
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []migration
+	for _, m := range migrations {
+		if m.version > current {
+			pending = append(pending, m)
+		}
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	if dryRun {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return nil, fmt.Errorf("开启事务失败: %w", err)
+		}
+		defer tx.Rollback()
+		for _, m := range pending {
+			if err = m.up(tx); err != nil {
+				return nil, fmt.Errorf("迁移 %d（%s）试运行失败: %w", m.version, m.description, err)
+			}
+		}
+		return pending, nil
+	}
+
+	for _, m := range pending {
+		if err = s.applyMigration(m); err != nil {
+			return nil, err
+		}
+	}
+	return pending, nil
+}
+
+func (s *LotteryStore) applyMigration(m migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err = m.up(tx); err != nil {
+		return fmt.Errorf("迁移 %d（%s）失败: %w", m.version, m.description, err)
+	}
+	_, err = tx.Exec(`INSERT INTO "schema_version" ("version", "description") VALUES (?, ?);`, m.version, m.description)
+	if err != nil {
+		return fmt.Errorf("记录迁移版本 %d 失败: %w", m.version, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("提交迁移 %d 失败: %w", m.version, err)
+	}
+	return nil
+}
+
+// SchemaVersion 返回数据库当前的版本号，未执行过任何迁移时为 0
+func (s *LotteryStore) SchemaVersion() (int, error) {
+	var version sql.NullInt64
+	err := s.db.QueryRow(`SELECT MAX("version") FROM "schema_version";`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("查询数据库版本失败: %w", err)
+	}
+	return int(version.Int64), nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import "testing"
+
+// TestMigration10Columns 冻结在迁移 10 中的拆分结果，期望值按迁移发布时保存的格式写死，不随现在的解析代码变化
+func TestMigration10Columns(t *testing.T) {
+	cases := []struct {
+		game, play, numbers   string
+		bankers, drags, blues string
+	}{
+		{"ssq", "", "01 05 12 19 23 33 16", "", "01,05,12,19,23,33", "16"},
+		{"ssq", "", "01 05 12 19 23 30 33+02 16", "", "01,05,12,19,23,30,33", "02,16"},
+		{"ssq", "", "05 12#01 19 23 30 33+16", "05,12", "01,19,23,30,33", "16"},
+		{"dlt", "", "03 09 17 25 35 01 12", "", "03,09,17,25,35", "01,12"},
+		{"dlt", "", "03 09#17 25 31 35+01 02 12", "03,09", "17,25,31,35", "01,02,12"},
+		{"3d", "zx", "7 0 7", "", "07", "00+07"},
+		{"3d", "z3", "7 0 7", "", "00", "07+07"},
+		{"3d", "z6", "9 2 5", "", "02", "05+09"},
+		{"qlc", "", "01 05 09 12 18 22 30", "", "01,05,09,12,18,22,30", ""},
+		{"kl8", "x5", "01 22 35 64 80", "", "01,22,35,64,80", ""},
+	}
+	for _, c := range cases {
+		bankers, drags, blues, err := migration10Columns(c.game, c.play, c.numbers)
+		if err != nil || bankers != c.bankers || drags != c.drags || blues != c.blues {
+			t.Errorf("%s %q: 拆分为 %q %q %q（%v），应为 %q %q %q", c.game, c.numbers, bankers, drags, blues, err, c.bankers, c.drags, c.blues)
+		}
+	}
+
+	for _, c := range []struct{ game, play, numbers string }{
+		{"ssq", "", "01 05 12 19 23 34 16"},
+		{"ssq", "", "01 05 12 19 23 16"},
+		{"dlt", "", "01 02+03"},
+		{"kl8", "", "01 02"},
+		{"ssq", "", "01 02 03 04 05#06+07"},
+		{"3d", "zx", "1+2+3"},
+		{"pl3", "", "1 2 3"},
+	} {
+		if _, _, _, err := migration10Columns(c.game, c.play, c.numbers); err == nil {
+			t.Errorf("%s %q 应解析失败", c.game, c.numbers)
+		}
+	}
+}
+
+// TestMigrateLegacyLotteryTable 从最初只有 lottery 一张表的旧库升级：试运行不改动数据库，正式迁移后数据拆分到新表
+func TestMigrateLegacyLotteryTable(t *testing.T) {
+	store := openTestStore(t)
+	tx, err := store.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = migrations[0].up(tx); err != nil {
+		t.Fatal(err)
+	}
+	//同一期的开奖结果在每注号码的行里重复出现；7 为当时的未中奖，未开奖的号码没有期号
+	_, err = tx.Exec(`INSERT INTO "lottery" ("id", "lottery", "create_time", "code", "date", "week", "red", "blue", "sales", "pool_money", "my_prize_grade", "red_count", "blue_count") VALUES
+		(1, '01 02 03 04 05 09 07', '2022-01-29 10:00:00', '2022013', '2022-01-30(日)', '日', '01,02,03,04,05,06', '07', '352641892', '', 3, 5, 1),
+		(2, '08 09 10 11 12 13 14', '2022-01-29 11:00:00', '2022013', '2022-01-30(日)', '日', '01,02,03,04,05,06', '07', '352641892', '', 7, 0, 0),
+		(5, '15 16 17 18 19 20 01', '2022-02-01 09:00:00', NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	tableCount := func(name string) int {
+		return countRows(t, store, `SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?;`, name)
+	}
+
+	//试运行执行全部迁移后回滚
+	pending, err := store.Migrate(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != len(migrations) {
+		t.Errorf("试运行应返回全部 %d 个迁移，实际 %d 个", len(migrations), len(pending))
+	}
+	if version, err := store.SchemaVersion(); err != nil || version != 0 {
+		t.Errorf("试运行后版本应仍为 0，实际 %d %v", version, err)
+	}
+	if tableCount("draws") != 0 || tableCount("tickets") != 0 || tableCount("lottery_legacy") != 0 {
+		t.Error("试运行后不应留下新表")
+	}
+	if n := countRows(t, store, `SELECT count(*) FROM "lottery";`); n != 3 {
+		t.Errorf("试运行后 lottery 应仍有 3 行，实际 %d 行", n)
+	}
+
+	if _, err = store.Migrate(false); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := store.SchemaVersion(); err != nil || version != migrations[len(migrations)-1].version {
+		t.Errorf("迁移后版本应为 %d，实际 %d %v", migrations[len(migrations)-1].version, version, err)
+	}
+	if n := countRows(t, store, `SELECT count(*) FROM "lottery_legacy";`); n != 3 {
+		t.Errorf("原表应改名保留 3 行，实际 %d 行", n)
+	}
+
+	draws, err := store.ListDraws("ssq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(draws) != 1 || draws[0].Code != "2022013" || draws[0].DrawDate != "2022-01-30" || draws[0].Red != "01,02,03,04,05,06" || draws[0].Blue != "07" {
+		t.Errorf("重复的开奖结果应合并为一期: %+v", draws)
+	}
+
+	cases := []struct {
+		id        int64
+		numbers   string
+		issueCode string
+	}{
+		{1, "01 02 03 04 05 09 07", "2022013"},
+		{2, "08 09 10 11 12 13 14", "2022013"},
+		{5, "15 16 17 18 19 20 01", ""},
+	}
+	for _, c := range cases {
+		ticket, err := store.GetTicket(c.id)
+		if err != nil {
+			t.Fatalf("号码 %d: %v", c.id, err)
+		}
+		if ticket.Game != "ssq" || ticket.Numbers != c.numbers || ticket.IssueCode != c.issueCode {
+			t.Errorf("号码 %d 迁移为 %+v", c.id, ticket)
+		}
+	}
+
+	//三等奖按固定奖金补齐；7 改为 0 表示未中奖，都按最初的规则计奖
+	results := []struct {
+		id    int64
+		grade int
+		money int64
+	}{
+		{1, 3, 300000},
+		{2, noPrize, 0},
+	}
+	for _, c := range results {
+		grade, money, ok := ticketResult(store, c.id)
+		if !ok || grade != c.grade || money != c.money {
+			t.Errorf("号码 %d 的计奖结果为 %d %d（%v），应为 %d %d", c.id, grade, money, ok, c.grade, c.money)
+		}
+	}
+	if n := countRows(t, store, `SELECT count(*) FROM "ticket_results" WHERE "rule_set" = 'ssq-2003';`); n != 2 {
+		t.Errorf("旧的计奖结果应记为 ssq-2003 规则，实际 %d 条", n)
+	}
+	if n := countRows(t, store, `SELECT count(*) FROM "ticket_results" WHERE "prize_grade" = 7;`); n != 0 {
+		t.Errorf("不应再有奖级 7 的结果，实际 %d 条", n)
+	}
+	if _, _, ok := ticketResult(store, 5); ok {
+		t.Error("未开奖的号码不应有计奖结果")
+	}
+
+	//已是最新版本时不再执行迁移
+	if applied, err := store.Migrate(false); err != nil || len(applied) != 0 {
+		t.Errorf("重复迁移应什么也不做，实际执行 %d 个 %v", len(applied), err)
+	}
+}
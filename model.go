@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Model 一个玩法的训练数据和按需训练的统计表，新的开奖号码通过 add 增量加入；
+// 服务中由 modelCache 缓存，回测、模拟时用临时的训练数据构建
+type Model struct {
+	History   []Ticket    // 历史开奖号码，按期号升序
+	Issues    []DrawIssue // 和 History 一一对应的期号和开奖日期，用已有号码临时构建的为空
+	LastIssue string      // 最后一期的期号，临时构建的为空
+
+	mu          sync.Mutex // 保护下面按需训练的部分，读锁下生成号码时可能同时训练
+	chains      map[markovConfig]*markovChain
+	counts      map[int]map[int]float64         // 区 -> 号码 -> 出现次数
+	transitions map[int]map[int]map[int]float64 // 区 -> 上一期的号码 -> 本期的号码 -> 次数
+}
+
+// DrawIssue 一期开奖的期号和开奖日期
+type DrawIssue struct {
+	Code     string
+	DrawDate string
+}
+
+// NewModel 用按期号升序的历史开奖号码构建模型
+func NewModel(history []Ticket, lastIssue string) *Model {
+	return &Model{History: history, LastIssue: lastIssue}
+}
+
+// TrainingSize 训练数据的期数
+func (m *Model) TrainingSize() int {
+	return len(m.History)
+}
+
+// add 追加新开奖的号码，已训练的统计表同步更新，不重新训练
+func (m *Model) add(draw Ticket, issue Draw) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, chain := range m.chains {
+		chain.add(draw)
+	}
+	for i := range m.counts {
+		addCounts(m.counts[i], draw, i)
+	}
+	if len(m.History) > 0 {
+		previous := m.History[len(m.History)-1]
+		for i := range m.transitions {
+			addTransitions(m.transitions[i], previous, draw, i)
+		}
+	}
+	m.History = append(m.History, draw)
+	m.Issues = append(m.Issues, DrawIssue{Code: issue.Code, DrawDate: issue.DrawDate})
+	m.LastIssue = issue.Code
+}
+
+// markovChain 按参数训练的第一个区的马尔可夫链
+func (m *Model) markovChain(config markovConfig) *markovChain {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.chains == nil {
+		m.chains = make(map[markovConfig]*markovChain)
+	}
+	chain, ok := m.chains[config]
+	if !ok {
+		chain = newMarkovChain(config)
+		for _, draw := range m.History {
+			chain.add(draw)
+		}
+		m.chains[config] = chain
+	}
+	return chain
+}
+
+// frequency 第 i 个区每个号码出现的次数，可直接作为 generateBlueNumbers 的概率表（选号时会归一化）
+func (m *Model) frequency(i int) map[int]float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.counts == nil {
+		m.counts = make(map[int]map[int]float64)
+	}
+	counts, ok := m.counts[i]
+	if !ok {
+		counts = make(map[int]float64)
+		for _, draw := range m.History {
+			addCounts(counts, draw, i)
+		}
+		m.counts[i] = counts
+	}
+	return counts
+}
+
+// transitionWeights 第 i 个区以上一期的号码为条件的权重：
+// 把上一期各号码在历史上转移到每个号码（下一期开出）的次数相加，再加上平滑值
+func (m *Model) transitionWeights(i int, zone Zone, smoothing float64) map[int]float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.transitions == nil {
+		m.transitions = make(map[int]map[int]map[int]float64)
+	}
+	transitions, ok := m.transitions[i]
+	if !ok {
+		transitions = make(map[int]map[int]float64)
+		for k := 1; k < len(m.History); k++ {
+			addTransitions(transitions, m.History[k-1], m.History[k], i)
+		}
+		m.transitions[i] = transitions
+	}
+
+	weights := make(map[int]float64)
+	if len(m.History) > 0 && i < len(m.History[len(m.History)-1].Zones) {
+		for _, from := range m.History[len(m.History)-1].Zones[i] {
+			for to, count := range transitions[from] {
+				weights[to] += count
+			}
+		}
+	}
+	if smoothing > 0 {
+		for n := zone.Min; n <= zone.Max; n++ {
+			weights[n] += smoothing
+		}
+	}
+	return weights
+}
+
+func addCounts(counts map[int]float64, draw Ticket, i int) {
+	if i < len(draw.Zones) {
+		for _, n := range draw.Zones[i] {
+			counts[n]++
+		}
+	}
+}
+
+func addTransitions(transitions map[int]map[int]float64, previous Ticket, draw Ticket, i int) {
+	if i >= len(previous.Zones) || i >= len(draw.Zones) {
+		return
+	}
+	for _, from := range previous.Zones[i] {
+		if transitions[from] == nil {
+			transitions[from] = make(map[int]float64)
+		}
+		for _, to := range draw.Zones[i] {
+			transitions[from][to]++
+		}
+	}
+}
+
+// modelCache 各玩法的模型，启动时载入，开奖结果入库后增量更新；
+// 生成号码时持有读锁，更新时持有写锁，生成过程中不会看到一半的数据
+type modelCache struct {
+	mu     sync.RWMutex
+	models map[string]*Model
+}
+
+func newModelCache() *modelCache {
+	return &modelCache{models: make(map[string]*Model)}
+}
+
+// Load 从数据库载入某个玩法的全部开奖号码，替换原来的模型
+func (c *modelCache) Load(store *LotteryStore, game Game) error {
+	draws, err := store.ListDraws(game.Code())
+	if err != nil {
+		return err
+	}
+	model, err := buildModel(game, draws)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.models[game.Code()] = model
+	return nil
+}
+
+// Refresh 把数据库中最后一期之后新入库的开奖号码加入模型，返回新加入的期数；
+// 如果回补了更早的期号，用全部开奖号码重新构建，返回全部期数
+func (c *modelCache) Refresh(store *LotteryStore, game Game) (int, error) {
+	draws, err := store.ListDraws(game.Code())
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	model, ok := c.models[game.Code()]
+	if !ok || len(draws) < model.TrainingSize() ||
+		(model.TrainingSize() > 0 && draws[model.TrainingSize()-1].Code != model.LastIssue) {
+		if model, err = buildModel(game, draws); err != nil {
+			return 0, err
+		}
+		c.models[game.Code()] = model
+		return len(draws), nil
+	}
+
+	added := 0
+	for _, draw := range draws[model.TrainingSize():] {
+		numbers, err := game.DrawNumbers(draw)
+		if err != nil {
+			return added, fmt.Errorf("第%s期开奖号码格式错误: %w", draw.Code, err)
+		}
+		model.add(numbers, draw)
+		added++
+	}
+	return added, nil
+}
+
+// buildModel 用按期号升序的开奖结果构建模型
+func buildModel(game Game, draws []Draw) (*Model, error) {
+	model := NewModel(nil, "")
+	for _, draw := range draws {
+		numbers, err := game.DrawNumbers(draw)
+		if err != nil {
+			return nil, fmt.Errorf("第%s期开奖号码格式错误: %w", draw.Code, err)
+		}
+		model.History = append(model.History, numbers)
+		model.Issues = append(model.Issues, DrawIssue{Code: draw.Code, DrawDate: draw.DrawDate})
+		model.LastIssue = draw.Code
+	}
+	return model, nil
+}
+
+// Generate 用缓存的模型按请求的生成方式和种子生成一注号码，同时返回训练数据最后一期的期号
+func (c *modelCache) Generate(game Game, req TicketRequest, seed int64) (Ticket, string, error) {
+	g, err := generatorByName(req.Strategy)
+	if err != nil {
+		return Ticket{}, "", err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	model := c.model(game)
+	ticket, err := generateFiltered(g, game, model, req, newRand(seed))
+	return ticket, model.LastIssue, err
+}
+
+// History 某个玩法当前的历史开奖号码，之后加入的开奖号码不会出现在返回的切片中
+func (c *modelCache) History(game Game) []Ticket {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	history := c.model(game).History
+	return history[:len(history):len(history)]
+}
+
+// Draws 某个玩法当前的历史开奖号码及对应的期号，和 History 一样不会看到之后加入的开奖号码
+func (c *modelCache) Draws(game Game) ([]Ticket, []DrawIssue) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	model := c.model(game)
+	history, issues := model.History, model.Issues
+	return history[:len(history):len(history)], issues[:len(issues):len(issues)]
+}
+
+// model 调用方持有锁；没有载入过的玩法返回空模型
+func (c *modelCache) model(game Game) *Model {
+	if model, ok := c.models[game.Code()]; ok {
+		return model
+	}
+	return NewModel(nil, "")
+}
+
+// ModelStatus 模型的训练数据规模
+type ModelStatus struct {
+	Game         string `json:"game"`
+	TrainingSize int    `json:"trainingSize"` // 训练数据的期数
+	LastIssue    string `json:"lastIssue"`    // 训练数据最后一期的期号
+}
+
+// Status 按玩法顺序返回各模型的训练数据规模
+func (c *modelCache) Status() []ModelStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var result []ModelStatus
+	for _, game := range allGames() {
+		model := c.model(game)
+		result = append(result, ModelStatus{Game: game.Code(), TrainingSize: model.TrainingSize(), LastIssue: model.LastIssue})
+	}
+	return result
+}
+
+// modelsFunc 返回各玩法模型的训练期数和最后一期的期号
+func (s *server) modelsFunc(w http.ResponseWriter, r *http.Request) {
+	bts, err := json.Marshal(s.models.Status())
+	if err != nil {
+		http.Error(w, "序列化模型状态失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bts)
+}
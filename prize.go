@@ -0,0 +1,44 @@
+package main
+
+import "fmt"
+
+// 金额统一以分为单位保存，避免浮点误差
+const ticketPrice int64 = 200 // 单注2元
+
+// calcPrizeMoney 根据奖级和当期开奖公告计算单注奖金（分）
+// 浮动奖级取公告 prizegrades 中对应奖级的单注金额，固定奖级取规则中的奖金；
+// 派奖期间公告会带上单注派奖金额（一等奖 mj1、二等奖 m2add、六等奖 mj6），叠加到对应奖级上
+func calcPrizeMoney(rules *RuleSet, play string, prizeGrade int, draw Draw) int64 {
+	tier := rules.Tier(play, prizeGrade)
+	if tier == nil {
+		return 0
+	}
+
+	money := tier.FixedMoney
+	if money == 0 {
+		for _, grade := range draw.PrizeGrades {
+			if grade.Type == prizeGrade {
+				if typeMoney := parseMoney(grade.TypeMoney); typeMoney.Valid {
+					money = typeMoney.Int64 * 100
+				}
+				break
+			}
+		}
+		if money == 0 {
+			fmt.Println("第", draw.Code, "期公告缺少", tier.Name, "单注奖金")
+			return 0
+		}
+	}
+
+	if tier.Promo != nil {
+		if add := parseMoney(tier.Promo(draw)); add.Valid && add.Int64 > 0 {
+			money += add.Int64 * 100
+		}
+	}
+	return money
+}
+
+// fenToYuan 分转换为元，仅用于展示
+func fenToYuan(fen int64) float64 {
+	return float64(fen) / 100
+}
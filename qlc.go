@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// qlcGame 七乐彩：从 1-30 中选 7 个号码，开奖时摇出 7 个基本号码和 1 个特别号码
+// 特别号码只参与二、四、六等奖的判定
+type qlcGame struct {
+	zoneGame
+}
+
+func newQlcGame() *qlcGame {
+	return &qlcGame{zoneGame{
+		code: "qlc",
+		name: "七乐彩",
+		zones: []Zone{
+			{Name: "号码", Pick: 7, Min: 1, Max: 30},
+		},
+		calendar:   newDrawCalendar([]time.Weekday{time.Monday, time.Wednesday, time.Friday}, 21, 15, 20, 0),
+		firstIssue: "2007001",
+		compound:   true,
+		ruleSets:   qlcRuleSets,
+	}}
+}
+
+func (g *qlcGame) DrawSizes() (int, int) {
+	return 7, 1
+}
+
+// DrawZones 开奖号码的两个区：7 个基本号码和 1 个特别号码，特别号码也在 1-30 中摇出
+func (g *qlcGame) DrawZones() []Zone {
+	return []Zone{g.zones[0], {Name: "特别号码", Pick: 1, Min: 1, Max: 30}}
+}
+
+// DrawNumbers 基本号码保存在 red，特别号码保存在 blue
+func (g *qlcGame) DrawNumbers(draw Draw) (Ticket, error) {
+	var ticket Ticket
+	basic, err := parseNumbers(draw.Red, ",")
+	if err != nil {
+		return ticket, err
+	}
+	special, err := parseNumbers(draw.Blue, ",")
+	if err != nil {
+		return ticket, err
+	}
+	if len(basic) != 7 || len(special) != 1 {
+		return ticket, fmt.Errorf("第%s期七乐彩开奖号码格式错误: %s+%s", draw.Code, draw.Red, draw.Blue)
+	}
+	ticket.Zones = [][]int{basic, special}
+	return ticket, nil
+}
+
+// Grade 返回 {基本号码命中数, 特别号码命中数}
+func (g *qlcGame) Grade(ticket Ticket, drawn Ticket, rules *RuleSet) ([]int, int) {
+	hits := []int{countHits(ticket.Zones[0], drawn.Zones[0]), countHits(ticket.Zones[0], drawn.Zones[1])}
+	if tier := rules.Grade(ticket.Play, hits...); tier != nil {
+		return hits, tier.Grade
+	}
+	return hits, noPrize
+}
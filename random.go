@@ -0,0 +1,62 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RandomSource 为每一注号码提供随机数种子。号码由以种子初始化的 math/rand 生成，
+// 种子和训练数据的最后一期随号码保存，之后可以原样复现
+type RandomSource interface {
+	// Seed 返回下一注号码的种子及其来源，即 Provenance 的 Seed、Entropy 等字段
+	Seed() (Provenance, error)
+}
+
+// newRandomSource 按 -random 参数创建：crypto 为 crypto/rand，seed:<n> 为以 n 为种子的确定序列，用于测试
+func newRandomSource(spec string) (RandomSource, error) {
+	if spec == "" || spec == "crypto" {
+		return cryptoRandom{}, nil
+	}
+	if strings.HasPrefix(spec, "seed:") {
+		seed, err := strconv.ParseInt(strings.TrimPrefix(spec, "seed:"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("随机数种子 %q 格式错误: %w", spec, err)
+		}
+		return &seededRandom{seed: seed, r: newRand(seed)}, nil
+	}
+	return nil, fmt.Errorf("不支持的随机数来源: %s", spec)
+}
+
+// newRand 以 seed 初始化的随机数，生成号码、回测和模拟都用它，相同的种子得到相同的序列
+func newRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed))
+}
+
+// cryptoRandom 每个种子都取自 crypto/rand，无法预测
+type cryptoRandom struct{}
+
+func (cryptoRandom) Seed() (Provenance, error) {
+	var buf [8]byte
+	if _, err := crand.Read(buf[:]); err != nil {
+		return Provenance{}, fmt.Errorf("读取随机数失败: %w", err)
+	}
+	return Provenance{Seed: int64(binary.BigEndian.Uint64(buf[:])), Entropy: "crypto"}, nil
+}
+
+// seededRandom 种子依次取自以固定种子初始化的序列，重启后按相同的请求顺序得到相同的号码
+type seededRandom struct {
+	mu   sync.Mutex
+	seed int64
+	r    *rand.Rand
+}
+
+func (s *seededRandom) Seed() (Provenance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Provenance{Seed: s.r.Int63(), Entropy: fmt.Sprintf("seed:%d", s.seed)}, nil
+}
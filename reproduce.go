@@ -0,0 +1,176 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Provenance 复现一注号码所需的信息，随号码保存在 tickets
+type Provenance struct {
+	Seed       int64  // 随机数种子
+	Entropy    string // 种子的来源，如 crypto、seed:42、hmac
+	ClientSeed string // hmac 模式下客户端提供的种子
+	Nonce      int64  // hmac 模式下同一个服务端种子生成的第几个种子
+	Commitment string // hmac 模式下生成时服务端种子的承诺，验证时和公布的服务端种子核对
+	ModelIssue string // 生成时训练数据最后一期的期号
+	Request    string // 复式、胆拖参数和过滤条件，如 compound=8%2B2
+}
+
+// encodeRequest 编码请求中的复式、胆拖参数和过滤条件，不带这些参数的单式号码为空串
+func encodeRequest(req TicketRequest) string {
+	values := url.Values{}
+	if len(req.Sizes) > 0 {
+		sizes := make([]string, len(req.Sizes))
+		for i, size := range req.Sizes {
+			sizes[i] = strconv.Itoa(size)
+		}
+		values.Set("compound", strings.Join(sizes, "+"))
+	}
+	if len(req.Bankers) > 0 {
+		values.Set("bankers", formatNumbers(req.Bankers, ","))
+	}
+	if len(req.Drags) > 0 {
+		values.Set("drags", formatNumbers(req.Drags, ","))
+	}
+	req.Filter.encode(values)
+	return values.Encode()
+}
+
+// decodeRequest 按保存的生成方式、参数和 encodeRequest 的结果还原生成号码的请求
+func decodeRequest(game Game, play string, strategy string, params string, request string) (TicketRequest, error) {
+	generator, err := generatorByName(strategy)
+	if err != nil {
+		return TicketRequest{}, err
+	}
+	req := TicketRequest{Strategy: generator.Name(), Play: play}
+	if req.Params, err = parseParams(generator, params); err != nil {
+		return TicketRequest{}, err
+	}
+	values, err := url.ParseQuery(request)
+	if err != nil {
+		return TicketRequest{}, fmt.Errorf("请求参数 %q 格式错误: %w", request, err)
+	}
+	if req.Sizes, err = parseSizes(values.Get("compound")); err != nil {
+		return TicketRequest{}, err
+	}
+	if req.Bankers, err = parseNumbers(values.Get("bankers"), ","); err != nil {
+		return TicketRequest{}, err
+	}
+	if req.Drags, err = parseNumbers(values.Get("drags"), ","); err != nil {
+		return TicketRequest{}, err
+	}
+	if req.Filter, err = parseFilter(values); err != nil {
+		return TicketRequest{}, err
+	}
+	return req, nil
+}
+
+// StoredTicket 数据库中的一注号码及其来源
+type StoredTicket struct {
+	Id         int64
+	Game       string
+	Play       string
+	Numbers    string
+	Strategy   string
+	Params     string
+	IssueCode  string
+	CreateTime string
+	HasSeed    bool // 升级前生成的号码没有保存种子
+	Provenance Provenance
+}
+
+// GetTicket 按 id 查询一注号码及复现它所需的信息，不存在时返回 sql.ErrNoRows
+func (s *LotteryStore) GetTicket(id int64) (StoredTicket, error) {
+	var t StoredTicket
+	var seed, nonce sql.NullInt64
+	var issueCode sql.NullString
+	err := s.db.QueryRow(`select id, game, play, numbers, strategy, params, issue_code, create_time,
+		seed, entropy, client_seed, nonce, commitment, model_issue, request
+		from tickets where id=?;`, id).Scan(&t.Id, &t.Game, &t.Play, &t.Numbers, &t.Strategy, &t.Params, &issueCode, &t.CreateTime,
+		&seed, &t.Provenance.Entropy, &t.Provenance.ClientSeed, &nonce, &t.Provenance.Commitment, &t.Provenance.ModelIssue, &t.Provenance.Request)
+	if err != nil {
+		return t, err
+	}
+	t.IssueCode = issueCode.String
+	t.HasSeed, t.Provenance.Seed, t.Provenance.Nonce = seed.Valid, seed.Int64, nonce.Int64
+	return t, nil
+}
+
+// reproduceTicket 用保存的种子和生成时的训练数据重新生成号码，返回重新生成的号码
+func reproduceTicket(store *LotteryStore, stored StoredTicket) (string, error) {
+	if !stored.HasSeed {
+		return "", fmt.Errorf("号码 %d 没有保存随机数种子，无法复现", stored.Id)
+	}
+	game, err := gameByCode(stored.Game)
+	if err != nil {
+		return "", err
+	}
+	req, err := decodeRequest(game, stored.Play, stored.Strategy, stored.Params, stored.Provenance.Request)
+	if err != nil {
+		return "", err
+	}
+	generator, err := generatorByName(req.Strategy)
+	if err != nil {
+		return "", err
+	}
+
+	//只用生成时已有的开奖数据训练
+	draws, err := store.ListDraws(game.Code())
+	if err != nil {
+		return "", err
+	}
+	var train []Draw
+	for _, draw := range draws {
+		if draw.Code <= stored.Provenance.ModelIssue {
+			train = append(train, draw)
+		}
+	}
+	model, err := buildModel(game, train)
+	if err != nil {
+		return "", err
+	}
+
+	ticket, err := generateFiltered(generator, game, model, req, newRand(stored.Provenance.Seed))
+	if err != nil {
+		return "", err
+	}
+	return game.FormatTicket(ticket), nil
+}
+
+// runReproduce 复现 reproduce 子命令指定的号码，和保存的号码比较
+//
+//	LotteryServer reproduce -id 12
+func runReproduce(store *LotteryStore, args []string) error {
+	fs := flag.NewFlagSet("reproduce", flag.ContinueOnError)
+	id := fs.Int64("id", 0, "号码的 id")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	stored, err := store.GetTicket(*id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("号码 %d 不存在", *id)
+	} else if err != nil {
+		return err
+	}
+	numbers, err := reproduceTicket(store, stored)
+	if err != nil {
+		return err
+	}
+
+	p := stored.Provenance
+	fmt.Printf("号码 %d：%s 生成方式 %s %s，生成时间 %s\n", stored.Id, stored.Numbers, stored.Strategy, stored.Params, stored.CreateTime)
+	if p.ModelIssue == "" {
+		fmt.Printf("种子 %d（%s），生成时没有训练数据\n", p.Seed, p.Entropy)
+	} else {
+		fmt.Printf("种子 %d（%s），训练数据截至第%s期\n", p.Seed, p.Entropy, p.ModelIssue)
+	}
+	if numbers != stored.Numbers {
+		return fmt.Errorf("复现的号码 %s 和保存的号码不一致", numbers)
+	}
+	fmt.Println("复现的号码一致")
+	return nil
+}
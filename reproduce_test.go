@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestReproduceTicketEveryStrategy 以固定种子用每种生成方式生成号码，之后有新的开奖结果入库，
+// 按保存的种子和训练数据复现的号码应和保存的完全一致
+func TestReproduceTicketEveryStrategy(t *testing.T) {
+	game, _ := gameByCode("ssq")
+	store := newTestStore(t)
+	items := ssqFixtureItems()
+	//先只入库 2021 年的 14 期
+	if _, err := saveKjggItems(store, game, items[:14]); err != nil {
+		t.Fatal(err)
+	}
+	s := &server{store: store, models: newModelCache()}
+	if err := s.models.Load(store, game); err != nil {
+		t.Fatal(err)
+	}
+	random, err := newRandomSource("seed:20220101")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variants := []struct {
+		name string
+		req  TicketRequest
+	}{
+		{"单式", TicketRequest{}},
+		{"复式", TicketRequest{Sizes: []int{8, 2}}},
+		{"胆拖", TicketRequest{Bankers: []int{3, 17}, Drags: []int{21}}},
+		{"过滤", TicketRequest{Filter: Filter{Include: []int{8}, Exclude: []int{1, 2}, Sum: &Range{Min: 80, Max: 120}}}},
+	}
+	type generated struct {
+		name    string
+		id      int64
+		numbers string
+	}
+	var tickets []generated
+	for _, g := range allGenerators() {
+		for _, v := range variants {
+			req := v.req
+			req.Strategy, req.Params = g.Name(), g.Params()
+			if g.Name() == "markov" {
+				req.Params["order"], req.Params["positional"], req.Params["smoothing"] = 2, 1, 1
+			}
+			ticket, provenance, err := s.generateTicket(game, req, random)
+			if err != nil {
+				t.Fatalf("%s %s: %v", g.Name(), v.name, err)
+			}
+			record := newTicketRecord(game, req, ticket, provenance)
+			id, err := store.InsertLottery(game.Code(), "2022001", record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tickets = append(tickets, generated{g.Name() + " " + v.name, id, record.Numbers})
+		}
+	}
+
+	//生成之后才入库的开奖结果不参与复现
+	if _, err = saveKjggItems(store, game, items[14:]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.models.Refresh(store, game); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ticket := range tickets {
+		stored, err := store.GetTicket(ticket.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Provenance.ModelIssue != "2021153" {
+			t.Errorf("%s: 训练数据应截至 2021153，实际 %s", ticket.name, stored.Provenance.ModelIssue)
+		}
+		reproduced, err := reproduceTicket(store, stored)
+		if err != nil {
+			t.Fatalf("%s: %v", ticket.name, err)
+		}
+		if reproduced != ticket.numbers {
+			t.Errorf("%s: 复现的号码为 %s，保存的为 %s", ticket.name, reproduced, ticket.numbers)
+		}
+	}
+}
+
+// TestGenerateSameSeedSameTicket 相同的模型、请求和种子得到相同的号码
+func TestGenerateSameSeedSameTicket(t *testing.T) {
+	for _, game := range allGames() {
+		play, err := gamePlay(game, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var history []Ticket
+		r := newRand(1)
+		for i := 0; i < 50; i++ {
+			ticket, err := randomGenerator{}.Generate(game, nil, TicketRequest{Play: play}, r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			history = append(history, ticket)
+		}
+		model := NewModel(history, "")
+		for _, g := range allGenerators() {
+			req := TicketRequest{Strategy: g.Name(), Params: g.Params(), Play: play}
+			a, err := g.Generate(game, model, req, newRand(42))
+			if err != nil {
+				t.Fatalf("%s %s: %v", game.Name(), g.Name(), err)
+			}
+			b, err := g.Generate(game, model, req, newRand(42))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if game.FormatTicket(a) != game.FormatTicket(b) {
+				t.Errorf("%s %s: 相同种子生成了 %s 和 %s", game.Name(), g.Name(), game.FormatTicket(a), game.FormatTicket(b))
+			}
+		}
+	}
+}
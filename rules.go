@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// noPrize 未中奖的奖级
+const noPrize = 0
+
+// PrizeTier 一个奖级：命中条件和单注奖金
+type PrizeTier struct {
+	Grade      int
+	Name       string
+	Play       string              // 只对该投注方式生效，为空时对所有投注方式生效
+	Matches    [][]int             // 满足其中任一组各区命中数量即中该奖级，如双色球 {红球数, 蓝球数}
+	FixedMoney int64               // 固定奖金（分），0 表示浮动奖金，取当期公告的单注金额
+	Promo      func(d Draw) string // 派奖期间公告中的单注派奖金额字段，没有派奖的奖级为 nil
+}
+
+// RuleSet 一套在某期（或某天）之后生效的游戏规则
+// EffectiveIssue、EffectiveDate 至少设置一个，同时设置时两个条件都满足才生效
+type RuleSet struct {
+	Name           string
+	EffectiveIssue string // 从该期起生效，如 2024134
+	EffectiveDate  string // 从该开奖日起生效，如 2024-11-18
+	Tiers          []PrizeTier
+}
+
+// Grade 根据投注方式和各区命中的数量返回奖级，未中奖返回 nil
+func (rs *RuleSet) Grade(play string, hits ...int) *PrizeTier {
+	for i := range rs.Tiers {
+		if rs.Tiers[i].Play != "" && rs.Tiers[i].Play != play {
+			continue
+		}
+		for _, m := range rs.Tiers[i].Matches {
+			if matchHits(m, hits) {
+				return &rs.Tiers[i]
+			}
+		}
+	}
+	return nil
+}
+
+func matchHits(match []int, hits []int) bool {
+	if len(match) != len(hits) {
+		return false
+	}
+	for i := range match {
+		if match[i] != hits[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Tier 返回某种投注方式指定奖级的定义
+func (rs *RuleSet) Tier(play string, grade int) *PrizeTier {
+	for i := range rs.Tiers {
+		if rs.Tiers[i].Play != "" && rs.Tiers[i].Play != play {
+			continue
+		}
+		if rs.Tiers[i].Grade == grade {
+			return &rs.Tiers[i]
+		}
+	}
+	return nil
+}
+
+// appliesTo 判断规则在某期是否已经生效
+func (rs *RuleSet) appliesTo(issueCode string, drawDate string) bool {
+	if rs.EffectiveIssue != "" && issueCode < rs.EffectiveIssue {
+		return false
+	}
+	if rs.EffectiveDate != "" && (drawDate == "" || drawDate < rs.EffectiveDate) {
+		return false
+	}
+	return true
+}
+
+// ssqBaseTiers 双色球一至六等奖，历次规则调整都沿用
+var ssqBaseTiers = []PrizeTier{
+	{Grade: 1, Name: "一等奖", Matches: [][]int{{6, 1}}, Promo: func(d Draw) string { return d.Mj1 }},
+	{Grade: 2, Name: "二等奖", Matches: [][]int{{6, 0}}, Promo: func(d Draw) string { return d.M2Add }},
+	{Grade: 3, Name: "三等奖", Matches: [][]int{{5, 1}}, FixedMoney: 300000},
+	{Grade: 4, Name: "四等奖", Matches: [][]int{{5, 0}, {4, 1}}, FixedMoney: 20000},
+	{Grade: 5, Name: "五等奖", Matches: [][]int{{4, 0}, {3, 1}}, FixedMoney: 1000},
+	{Grade: 6, Name: "六等奖", Matches: [][]int{{2, 1}, {1, 1}, {0, 1}}, FixedMoney: 500, Promo: func(d Draw) string { return d.Mj6 }},
+}
+
+// ssqRuleSets 双色球规则，按生效先后排列，新规则追加在末尾，已生效的规则不要修改，
+// 否则重新计奖时旧号码会得到和当时不一样的结果
+var ssqRuleSets = []RuleSet{
+	{
+		Name:           "ssq-2003",
+		EffectiveIssue: "2003001",
+		Tiers:          ssqBaseTiers,
+	},
+	{
+		// 2024年规则调整新增福运奖：命中任意3个红球（不含蓝球）
+		Name:          "ssq-2024",
+		EffectiveDate: "2024-11-18",
+		Tiers: append(append([]PrizeTier(nil), ssqBaseTiers...),
+			PrizeTier{Grade: 7, Name: "福运奖", Matches: [][]int{{3, 0}}, FixedMoney: 500}),
+	},
+}
+
+// dltRuleSets 大乐透规则（基本投注，不含追加），按生效先后排列，新规则追加在末尾，已生效的规则不要修改
+var dltRuleSets = []RuleSet{
+	{
+		// 2019年之前的六个奖级，三等奖起为多种命中组合；更早的期号也按这套规则计奖
+		Name:           "dlt-2014",
+		EffectiveIssue: "2007001",
+		Tiers: []PrizeTier{
+			{Grade: 1, Name: "一等奖", Matches: [][]int{{5, 2}}},
+			{Grade: 2, Name: "二等奖", Matches: [][]int{{5, 1}}},
+			{Grade: 3, Name: "三等奖", Matches: [][]int{{5, 0}, {4, 2}}},
+			{Grade: 4, Name: "四等奖", Matches: [][]int{{4, 1}, {3, 2}}, FixedMoney: 20000},
+			{Grade: 5, Name: "五等奖", Matches: [][]int{{4, 0}, {3, 1}, {2, 2}}, FixedMoney: 1000},
+			{Grade: 6, Name: "六等奖", Matches: [][]int{{3, 0}, {2, 1}, {1, 2}, {0, 2}}, FixedMoney: 500},
+		},
+	},
+	{
+		// 2019年第19014期起调整为九个奖级
+		Name:           "dlt-2019",
+		EffectiveIssue: "2019014",
+		Tiers: []PrizeTier{
+			{Grade: 1, Name: "一等奖", Matches: [][]int{{5, 2}}},
+			{Grade: 2, Name: "二等奖", Matches: [][]int{{5, 1}}},
+			{Grade: 3, Name: "三等奖", Matches: [][]int{{5, 0}}, FixedMoney: 1000000},
+			{Grade: 4, Name: "四等奖", Matches: [][]int{{4, 2}}, FixedMoney: 300000},
+			{Grade: 5, Name: "五等奖", Matches: [][]int{{4, 1}}, FixedMoney: 30000},
+			{Grade: 6, Name: "六等奖", Matches: [][]int{{3, 2}}, FixedMoney: 20000},
+			{Grade: 7, Name: "七等奖", Matches: [][]int{{4, 0}}, FixedMoney: 10000},
+			{Grade: 8, Name: "八等奖", Matches: [][]int{{3, 1}, {2, 2}}, FixedMoney: 1500},
+			{Grade: 9, Name: "九等奖", Matches: [][]int{{3, 0}, {2, 1}, {1, 2}, {0, 2}}, FixedMoney: 500},
+		},
+	},
+}
+
+// fc3dRuleSets 福彩3D单选投注，奖金固定
+var fc3dRuleSets = []RuleSet{
+	{
+		Name:           "3d",
+		EffectiveIssue: "2004001",
+		Tiers: []PrizeTier{
+			// 直选：三个位置依次相同
+			{Grade: 1, Name: "直选", Play: "zx", Matches: [][]int{{1, 1, 1}}, FixedMoney: 104000},
+			// 组三、组六：号码相同、顺序不限
+			{Grade: 2, Name: "组三", Play: "z3", Matches: [][]int{{3}}, FixedMoney: 34600},
+			{Grade: 3, Name: "组六", Play: "z6", Matches: [][]int{{3}}, FixedMoney: 17300},
+		},
+	},
+}
+
+// qlcRuleSets 七乐彩，{基本号码命中数, 特别号码命中数}
+var qlcRuleSets = []RuleSet{
+	{
+		Name:           "qlc",
+		EffectiveIssue: "2007001",
+		Tiers: []PrizeTier{
+			{Grade: 1, Name: "一等奖", Matches: [][]int{{7, 0}}},
+			{Grade: 2, Name: "二等奖", Matches: [][]int{{6, 1}}},
+			{Grade: 3, Name: "三等奖", Matches: [][]int{{6, 0}}},
+			{Grade: 4, Name: "四等奖", Matches: [][]int{{5, 1}}, FixedMoney: 20000},
+			{Grade: 5, Name: "五等奖", Matches: [][]int{{5, 0}}, FixedMoney: 5000},
+			{Grade: 6, Name: "六等奖", Matches: [][]int{{4, 1}}, FixedMoney: 1000},
+			{Grade: 7, Name: "七等奖", Matches: [][]int{{4, 0}}, FixedMoney: 500},
+		},
+	},
+}
+
+// kl8Prizes 快乐8各投注方式命中个数对应的单注奖金（分），按命中个数从多到少排列
+// 选十中10 为浮动奖金，这里按封顶的500万元计算
+var kl8Prizes = []struct {
+	play   string
+	prizes [][2]int64 // {命中个数, 奖金}
+}{
+	{"x10", [][2]int64{{10, 500000000}, {9, 800000}, {8, 80000}, {7, 8000}, {6, 500}, {5, 300}, {0, 200}}},
+	{"x9", [][2]int64{{9, 30000000}, {8, 200000}, {7, 20000}, {6, 2000}, {5, 500}, {4, 300}, {0, 200}}},
+	{"x8", [][2]int64{{8, 5000000}, {7, 80000}, {6, 8800}, {5, 1000}, {4, 300}, {0, 200}}},
+	{"x7", [][2]int64{{7, 1000000}, {6, 28800}, {5, 2800}, {4, 400}, {0, 200}}},
+	{"x6", [][2]int64{{6, 300000}, {5, 3000}, {4, 1000}, {3, 300}}},
+	{"x5", [][2]int64{{5, 100000}, {4, 2100}, {3, 300}}},
+	{"x4", [][2]int64{{4, 10000}, {3, 500}, {2, 300}}},
+	{"x3", [][2]int64{{3, 5300}, {2, 300}}},
+	{"x2", [][2]int64{{2, 1900}}},
+	{"x1", [][2]int64{{1, 460}}},
+}
+
+// kl8Tiers 每种投注方式的奖级从 1 开始编号，命中越多奖级越高
+func kl8Tiers() []PrizeTier {
+	var tiers []PrizeTier
+	for _, p := range kl8Prizes {
+		for i, prize := range p.prizes {
+			tiers = append(tiers, PrizeTier{
+				Grade:      i + 1,
+				Name:       fmt.Sprintf("选%s中%d", strings.TrimPrefix(p.play, "x"), prize[0]),
+				Play:       p.play,
+				Matches:    [][]int{{int(prize[0])}},
+				FixedMoney: prize[1],
+			})
+		}
+	}
+	return tiers
+}
+
+// kl8RuleSets 快乐8
+var kl8RuleSets = []RuleSet{
+	{
+		Name:           "kl8",
+		EffectiveIssue: "2020001",
+		Tiers:          kl8Tiers(),
+	},
+}
+
+// ruleSetFor 返回某期开奖时生效的规则，ruleSets 按生效先后排列
+func ruleSetFor(ruleSets []RuleSet, issueCode string, drawDate string) *RuleSet {
+	rules := &ruleSets[0]
+	for i := range ruleSets {
+		if ruleSets[i].appliesTo(issueCode, drawDate) {
+			rules = &ruleSets[i]
+		}
+	}
+	return rules
+}
@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestKl8Prizes(t *testing.T) {
+	game, _ := gameByCode("kl8")
+	rules := game.RuleSetFor("2022001", "2022-01-01")
+	cases := []struct {
+		play  string
+		hits  int
+		money int64
+	}{
+		{"x10", 10, 500000000},
+		{"x10", 0, 200},
+		{"x9", 0, 200},
+		{"x8", 0, 200},
+		{"x7", 0, 200},
+		{"x1", 1, 460},
+	}
+	for _, c := range cases {
+		tier := rules.Grade(c.play, c.hits)
+		if tier == nil || tier.FixedMoney != c.money {
+			t.Errorf("%s 中%d 应为 %d 分，实际 %+v", c.play, c.hits, c.money, tier)
+		}
+	}
+	if tier := rules.Grade("x6", 0); tier != nil {
+		t.Errorf("选六中0 不中奖，实际 %+v", tier)
+	}
+}
+
+func TestDltRuleSetByIssue(t *testing.T) {
+	game, _ := gameByCode("dlt")
+	cases := []struct {
+		issue string
+		hits  []int
+		name  string
+		grade int
+		money int64
+	}{
+		//4+2 在 2019 年之前是浮动奖金的三等奖，之后是 3000 元的四等奖
+		{"2018153", []int{4, 2}, "dlt-2014", 3, 0},
+		{"2019013", []int{3, 1}, "dlt-2014", 5, 1000},
+		{"2019014", []int{4, 2}, "dlt-2019", 4, 300000},
+		{"2019014", []int{3, 1}, "dlt-2019", 8, 1500},
+	}
+	for _, c := range cases {
+		rules := game.RuleSetFor(c.issue, "")
+		tier := rules.Grade("", c.hits...)
+		if rules.Name != c.name || tier == nil || tier.Grade != c.grade || tier.FixedMoney != c.money {
+			t.Errorf("第%s期命中 %v 应按 %s 中%d等奖 %d 分，实际按 %s 为 %+v", c.issue, c.hits, c.name, c.grade, c.money, rules.Name, tier)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// simulateBatchSize 每个批次模拟的开奖次数，每个批次使用独立的种子，
+// 结果只和总次数、种子有关，和 worker 的数量无关
+const simulateBatchSize = 10000
+
+// simulateOptions 蒙特卡洛模拟的参数
+type simulateOptions struct {
+	Strategy string
+	Params   map[string]int
+	Play     string
+	Tickets  int // 用生成方式生成的注数，每次模拟开奖都对这些号码计奖
+	Draws    int // 模拟开奖的次数
+	Workers  int
+	Seed     int64
+	Refresh  bool // 忽略缓存重新模拟
+}
+
+// simulationResult 模拟结果，按 JSON 缓存在 simulations 表
+type simulationResult struct {
+	Tickets       []string        `json:"tickets"`
+	Draws         int             `json:"draws"`
+	Bets          int64           `json:"bets"`  // 单式注数 × 模拟次数
+	Tiers         map[int]int64   `json:"tiers"` // 奖级 -> 中奖注数
+	Prize         int64           `json:"prize"` // 分
+	SumSquares    float64         `json:"sumSquares"`
+	LongestLosing int             `json:"longestLosing"` // 最长连续不中奖的开奖次数
+	TierMoney     map[int]float64 `json:"tierMoney"`     // 奖级 -> 单注奖金（元）
+}
+
+// Mean 平均每注（2元）的奖金，元
+func (r *simulationResult) Mean() float64 {
+	if r.Bets == 0 {
+		return 0
+	}
+	return fenToYuan(r.Prize) / float64(r.Bets)
+}
+
+// Variance 每注奖金的方差，元²
+func (r *simulationResult) Variance() float64 {
+	if r.Bets == 0 {
+		return 0
+	}
+	mean := r.Mean()
+	return r.SumSquares/float64(r.Bets) - mean*mean
+}
+
+// ROI 回报率，(奖金-投入)/投入
+func (r *simulationResult) ROI() float64 {
+	if r.Bets == 0 {
+		return 0
+	}
+	cost := r.Bets * ticketPrice
+	return float64(r.Prize-cost) / float64(cost)
+}
+
+// simulatedBatch 一个批次的统计，按批次顺序合并后得到最长连续不中奖次数
+type simulatedBatch struct {
+	Draws   int
+	Bets    int64
+	Tiers   map[int]int64
+	Money   map[int]int64 // 奖级 -> 单注奖金（分），各批次相同
+	Prize   int64
+	Squares float64
+	Prefix  int  // 批次开头连续不中奖的次数
+	Suffix  int  // 批次结尾连续不中奖的次数
+	Longest int  // 批次内最长连续不中奖的次数
+	AllLost bool // 整个批次都没有中奖
+}
+
+// runSimulate 解析 simulate 子命令的参数，模拟后输出报告
+//
+//	LotteryServer simulate [-game ssq] [-strategy markov] [-params order=2&smoothing=1] [-tickets 5] [-draws 1000000] [-workers 8] [-seed 1] [-refresh]
+func runSimulate(store *LotteryStore, args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	var opts simulateOptions
+	gameCode := fs.String("game", defaultGameCode, "玩法：ssq、dlt、3d、qlc、kl8")
+	fs.StringVar(&opts.Strategy, "strategy", defaultStrategy, "生成方式")
+	params := fs.String("params", "", "生成方式的参数，如 order=2&smoothing=1、window=50，没有的取默认值")
+	fs.StringVar(&opts.Play, "play", "", "投注方式，为空时为该玩法默认的投注方式")
+	fs.IntVar(&opts.Tickets, "tickets", 5, "生成的注数")
+	fs.IntVar(&opts.Draws, "draws", 1000000, "模拟开奖的次数")
+	fs.IntVar(&opts.Workers, "workers", runtime.NumCPU(), "并行计奖的 worker 数量")
+	fs.Int64Var(&opts.Seed, "seed", 1, "随机数种子，相同的种子和数据得到相同的结果")
+	fs.BoolVar(&opts.Refresh, "refresh", false, "忽略缓存重新模拟")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	game, err := gameByCode(*gameCode)
+	if err != nil {
+		return err
+	}
+	if opts.Play, err = gamePlay(game, opts.Play); err != nil {
+		return err
+	}
+	generator, err := generatorByName(opts.Strategy)
+	if err != nil {
+		return err
+	}
+	opts.Strategy = generator.Name()
+	if opts.Params, err = parseParams(generator, *params); err != nil {
+		return err
+	}
+	if opts.Tickets < 1 || opts.Draws < 1 || opts.Workers < 1 {
+		return fmt.Errorf("注数、模拟次数和 worker 数量都应大于0")
+	}
+
+	draws, err := store.ListDraws(game.Code())
+	if err != nil {
+		return err
+	}
+	if len(draws) == 0 {
+		return fmt.Errorf("%s没有开奖数据，无法训练生成方式和确定浮动奖级的奖金", game.Name())
+	}
+	latest := draws[len(draws)-1]
+
+	key := simulationKey{Game: game.Code(), Strategy: opts.Strategy, Params: encodeParams(opts.Params), Play: opts.Play,
+		Tickets: opts.Tickets, Draws: opts.Draws, Seed: opts.Seed, HistoryCode: latest.Code}
+	if !opts.Refresh {
+		cached, err := store.CachedSimulation(key)
+		if err != nil {
+			return err
+		}
+		if cached != nil {
+			fmt.Println("使用缓存的模拟结果，加 -refresh 重新模拟")
+			printSimulation(game, opts, latest, cached)
+			return nil
+		}
+	}
+
+	history, err := store.ReadHistoryData(game)
+	if err != nil {
+		return err
+	}
+	result, err := simulate(game, NewModel(history, latest.Code), latest, opts)
+	if err != nil {
+		return err
+	}
+	if err = store.SaveSimulation(key, result); err != nil {
+		return err
+	}
+	printSimulation(game, opts, latest, result)
+	return nil
+}
+
+// simulate 用生成方式生成 opts.Tickets 注号码，再模拟 opts.Draws 次均匀随机的开奖逐次计奖
+// 计奖的规则和浮动奖级的奖金取自最近一期 latest
+func simulate(game Game, model *Model, latest Draw, opts simulateOptions) (*simulationResult, error) {
+	generator, err := generatorByName(opts.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	r := newRand(opts.Seed)
+	var tickets []Ticket
+	result := &simulationResult{Draws: opts.Draws, Tiers: make(map[int]int64), TierMoney: make(map[int]float64)}
+	for i := 0; i < opts.Tickets; i++ {
+		ticket, err := generator.Generate(game, model, TicketRequest{Strategy: opts.Strategy, Params: opts.Params, Play: opts.Play}, r)
+		if err != nil {
+			return nil, fmt.Errorf("%s生成号码失败: %w", opts.Strategy, err)
+		}
+		tickets = append(tickets, ticket)
+		result.Tickets = append(result.Tickets, game.FormatTicket(ticket))
+	}
+
+	batches := (opts.Draws + simulateBatchSize - 1) / simulateBatchSize
+	results := make([]simulatedBatch, batches)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range jobs {
+				size := simulateBatchSize
+				if b == batches-1 {
+					size = opts.Draws - b*simulateBatchSize
+				}
+				results[b] = simulateBatch(game, tickets, latest, size, newRand(opts.Seed+int64(b)+1))
+			}
+		}()
+	}
+	for b := 0; b < batches; b++ {
+		jobs <- b
+	}
+	close(jobs)
+	wg.Wait()
+
+	//按批次顺序合并，连续不中奖可以跨越批次
+	streak := 0
+	for _, batch := range results {
+		result.Bets += batch.Bets
+		result.Prize += batch.Prize
+		result.SumSquares += batch.Squares
+		for grade, count := range batch.Tiers {
+			result.Tiers[grade] += count
+		}
+		for grade, money := range batch.Money {
+			result.TierMoney[grade] = fenToYuan(money)
+		}
+		if streak+batch.Prefix > result.LongestLosing {
+			result.LongestLosing = streak + batch.Prefix
+		}
+		if batch.Longest > result.LongestLosing {
+			result.LongestLosing = batch.Longest
+		}
+		if batch.AllLost {
+			streak += batch.Draws
+		} else {
+			streak = batch.Suffix
+		}
+	}
+	return result, nil
+}
+
+// simulateBatch 模拟 size 次开奖，用和实际计奖相同的 gradeNumbers 对每注号码计奖
+func simulateBatch(game Game, tickets []Ticket, latest Draw, size int, r *rand.Rand) simulatedBatch {
+	batch := simulatedBatch{Draws: size, Tiers: make(map[int]int64), Money: make(map[int]int64), AllLost: true}
+	bets := int64(0)
+	for _, ticket := range tickets {
+		bets += int64(ticketBets(game, ticket))
+	}
+
+	streak := 0
+	for i := 0; i < size; i++ {
+		drawn := syntheticDraw(game, r)
+		won := false
+		for _, ticket := range tickets {
+			for _, tier := range gradeNumbers(game, ticket, drawn, latest).Tiers {
+				batch.Tiers[tier.PrizeGrade] += int64(tier.BetCount)
+				batch.Prize += tier.PrizeMoney
+				each := tier.PrizeMoney / int64(tier.BetCount)
+				batch.Money[tier.PrizeGrade] = each
+				batch.Squares += float64(tier.BetCount) * fenToYuan(each) * fenToYuan(each)
+				won = true
+			}
+		}
+		batch.Bets += bets
+
+		if won {
+			if batch.AllLost {
+				batch.Prefix = streak
+				batch.AllLost = false
+			}
+			streak = 0
+			continue
+		}
+		streak++
+		if streak > batch.Longest {
+			batch.Longest = streak
+		}
+	}
+	if batch.AllLost {
+		batch.Prefix = size
+	}
+	batch.Suffix = streak
+	return batch
+}
+
+// syntheticDraw 按玩法的开奖方式均匀随机地开出一期：
+// 多个区的玩法每个区各开出 Pick 个（福彩3D每位一个数字）；
+// 只有一个区的玩法从该区开出 DrawSizes 个，其中特别号码（七乐彩）放在第二个区
+func syntheticDraw(game Game, r *rand.Rand) Ticket {
+	zones := game.Zones()
+	var drawn Ticket
+	if len(zones) == 1 {
+		red, blue := game.DrawSizes()
+		numbers := r.Perm(zones[0].Max - zones[0].Min + 1)[:red+blue]
+		for i := range numbers {
+			numbers[i] += zones[0].Min
+		}
+		basic := append([]int(nil), numbers[:red]...)
+		sort.Ints(basic)
+		drawn.Zones = append(drawn.Zones, basic)
+		if blue > 0 {
+			special := append([]int(nil), numbers[red:]...)
+			sort.Ints(special)
+			drawn.Zones = append(drawn.Zones, special)
+		}
+		return drawn
+	}
+	for _, zone := range zones {
+		numbers := r.Perm(zone.Max - zone.Min + 1)[:zone.Pick]
+		for i := range numbers {
+			numbers[i] += zone.Min
+		}
+		sort.Ints(numbers)
+		drawn.Zones = append(drawn.Zones, numbers)
+	}
+	return drawn
+}
+
+// printSimulation 输出各奖级的中奖注数和概率、平均每注奖金、方差和最长连续不中奖次数
+func printSimulation(game Game, opts simulateOptions, latest Draw, result *simulationResult) {
+	fmt.Printf("%s模拟：生成方式 %s %s，模拟开奖%d次，种子 %d，规则和浮动奖金取第%s期\n",
+		game.Name(), opts.Strategy, encodeParams(opts.Params), result.Draws, opts.Seed, latest.Code)
+	fmt.Println("号码:", strings.Join(result.Tickets, " | "))
+
+	var grades []int
+	for grade := range result.Tiers {
+		grades = append(grades, grade)
+	}
+	sort.Ints(grades)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "奖级\t中奖注数\t概率\t单注奖金(元)")
+	for _, grade := range grades {
+		fmt.Fprintf(w, "%d等奖\t%d\t%.8f\t%.2f\n", grade, result.Tiers[grade], float64(result.Tiers[grade])/float64(result.Bets), result.TierMoney[grade])
+	}
+	w.Flush()
+
+	fmt.Printf("注数 %d，每注（2元）平均奖金 %.4f 元，回报率 %.2f%%，方差 %.4f，标准差 %.4f，最长连续不中奖 %d 次\n",
+		result.Bets, result.Mean(), result.ROI()*100, result.Variance(), math.Sqrt(result.Variance()), result.LongestLosing)
+}
+
+// simulationKey 模拟结果缓存的键，开奖数据更新后 HistoryCode 不同，需要重新模拟
+type simulationKey struct {
+	Game        string
+	Strategy    string
+	Params      string
+	Play        string
+	Tickets     int
+	Draws       int
+	Seed        int64
+	HistoryCode string
+}
+
+// CachedSimulation 查询缓存的模拟结果，没有时返回 nil
+func (s *LotteryStore) CachedSimulation(key simulationKey) (*simulationResult, error) {
+	var data string
+	err := s.db.QueryRow(`select result from simulations where game=? and strategy=? and params=? and play=?
+		and tickets=? and draws=? and seed=? and history_code=?;`,
+		key.Game, key.Strategy, key.Params, key.Play, key.Tickets, key.Draws, key.Seed, key.HistoryCode).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询模拟缓存失败: %w", err)
+	}
+	var result simulationResult
+	if err = json.Unmarshal([]byte(data), &result); err != nil {
+		return nil, fmt.Errorf("解析模拟缓存失败: %w", err)
+	}
+	return &result, nil
+}
+
+// SaveSimulation 保存模拟结果，相同的键覆盖旧结果
+func (s *LotteryStore) SaveSimulation(key simulationKey, result *simulationResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("序列化模拟结果失败: %w", err)
+	}
+	_, err = s.db.Exec(`insert or replace into simulations (game, strategy, params, play, tickets, draws, seed, history_code, result)
+		values (?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		key.Game, key.Strategy, key.Params, key.Play, key.Tickets, key.Draws, key.Seed, key.HistoryCode, string(data))
+	if err != nil {
+		return fmt.Errorf("保存模拟结果失败: %w", err)
+	}
+	return nil
+}
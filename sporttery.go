@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sportteryBaseUrl 体彩官网的历史开奖接口
+var sportteryBaseUrl = "https://webapi.sporttery.cn/gateway/lottery/getHistoryPageListV1.qry"
+
+// sportteryGameNos 体彩官网接口 gameNo 参数对应的玩法
+var sportteryGameNos = map[string]string{
+	"dlt": "85",
+}
+
+// sportteryData 体彩官网历史开奖接口的返回
+type sportteryData struct {
+	Success      bool   `json:"success"`
+	ErrorCode    string `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+	Value        struct {
+		List     []sportteryDraw `json:"list"`
+		PageNo   int             `json:"pageNo"`
+		PageSize int             `json:"pageSize"`
+		Pages    int             `json:"pages"`
+		Total    int             `json:"total"`
+	} `json:"value"`
+}
+
+type sportteryDraw struct {
+	LotteryDrawNum       string                `json:"lotteryDrawNum"`    // 五位期号，如 24130
+	LotteryDrawResult    string                `json:"lotteryDrawResult"` // 空格分隔，前区在前后区在后
+	LotteryDrawTime      string                `json:"lotteryDrawTime"`   // 2024-11-13
+	PoolBalanceAfterdraw string                `json:"poolBalanceAfterdraw"`
+	TotalSaleAmount      string                `json:"totalSaleAmount"`
+	DrawPdfUrl           string                `json:"drawPdfUrl"`
+	PrizeLevelList       []sportteryPrizeLevel `json:"prizeLevelList"`
+}
+
+type sportteryPrizeLevel struct {
+	PrizeLevel  string `json:"prizeLevel"` // 一等奖、一等奖(追加) 等
+	StakeCount  string `json:"stakeCount"`
+	StakeAmount string `json:"stakeAmount"`
+	Sort        int    `json:"sort"`
+}
+
+// sportteryPrizeLevels 奖级名称对应的奖级，追加投注的奖级不记录
+var sportteryPrizeLevels = map[string]int{
+	"一等奖": 1, "二等奖": 2, "三等奖": 3, "四等奖": 4, "五等奖": 5,
+	"六等奖": 6, "七等奖": 7, "八等奖": 8, "九等奖": 9,
+}
+
+var chineseWeekdays = []string{"日", "一", "二", "三", "四", "五", "六"}
+
+// sportteryDrawSource 从体彩官网获取开奖结果，转换为和福彩公告相同的 KjggItem
+// 体彩的期号只有五位，入库时补全为和双色球一致的七位，如 24130 -> 2024130
+type sportteryDrawSource struct {
+	throttle
+	client   *http.Client
+	baseUrl  string
+	gameNo   string
+	pageSize int
+}
+
+func newSportteryDrawSource(baseUrl string, gameNo string, interval time.Duration) *sportteryDrawSource {
+	return &sportteryDrawSource{
+		throttle: throttle{interval: interval},
+		client:   &http.Client{Timeout: 10 * time.Second},
+		baseUrl:  baseUrl,
+		gameNo:   gameNo,
+		pageSize: 30,
+	}
+}
+
+func (s *sportteryDrawSource) Latest(n int) ([]KjggItem, error) {
+	data, err := s.query(url.Values{"pageNo": {"1"}, "pageSize": {strconv.Itoa(n)}})
+	if err != nil {
+		return nil, err
+	}
+	return s.convert(data.Value.List), nil
+}
+
+func (s *sportteryDrawSource) Range(from string, to string) ([]KjggItem, error) {
+	params := url.Values{"startTerm": {shortIssueCode(from)}}
+	if to != "" {
+		params.Set("endTerm", shortIssueCode(to))
+	}
+	return s.fetchAll(params)
+}
+
+// DayRange 接口不支持按日期查询，按年份取出涉及的各期再按日期筛选
+func (s *sportteryDrawSource) DayRange(dayStart string, dayEnd string) ([]KjggItem, error) {
+	params := url.Values{}
+	if len(dayStart) >= 4 {
+		params.Set("startTerm", shortIssueCode(dayStart[:4]+"001"))
+	}
+	if len(dayEnd) >= 4 {
+		params.Set("endTerm", shortIssueCode(dayEnd[:4]+"999"))
+	}
+	items, err := s.fetchAll(params)
+	if err != nil {
+		return nil, err
+	}
+	return filterKjggItems(items, "", "", dayStart, dayEnd), nil
+}
+
+// fetchAll 按 pages 逐页请求，直到取完 total 期
+func (s *sportteryDrawSource) fetchAll(params url.Values) ([]KjggItem, error) {
+	params.Set("pageSize", strconv.Itoa(s.pageSize))
+
+	var draws []sportteryDraw
+	for pageNo := 1; ; pageNo++ {
+		params.Set("pageNo", strconv.Itoa(pageNo))
+		data, err := s.query(params)
+		if err != nil {
+			return nil, fmt.Errorf("请求第%d页失败: %w", pageNo, err)
+		}
+		draws = append(draws, data.Value.List...)
+		if pageNo >= data.Value.Pages || len(data.Value.List) == 0 {
+			if data.Value.Total > 0 && len(draws) != data.Value.Total {
+				fmt.Printf("体彩开奖公告共%d期，实际取到%d期\n", data.Value.Total, len(draws))
+			}
+			break
+		}
+	}
+	return s.convert(draws), nil
+}
+
+func (s *sportteryDrawSource) query(params url.Values) (sportteryData, error) {
+	var data sportteryData
+
+	query := url.Values{}
+	for k, v := range params {
+		query[k] = v
+	}
+	query.Set("gameNo", s.gameNo)
+	query.Set("provinceId", "0")
+	query.Set("isVerify", "1")
+
+	req, err := http.NewRequest("GET", s.baseUrl+"?"+query.Encode(), nil)
+	if err != nil {
+		return data, err
+	}
+	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/97.0.4692.99 Safari/537.36")
+	req.Header.Add("Accept", "application/json, text/javascript, */*; q=0.01")
+
+	s.wait()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return data, fmt.Errorf("请求体彩开奖公告失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	result, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return data, fmt.Errorf("读取体彩开奖公告失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return data, fmt.Errorf("请求体彩开奖公告失败，状态码: %d", resp.StatusCode)
+	}
+	if err = json.Unmarshal(result, &data); err != nil {
+		return data, fmt.Errorf("结构化体彩开奖公告结果发生错误: %w", err)
+	}
+	if !data.Success {
+		return data, fmt.Errorf("体彩开奖公告接口返回错误: %s %s", data.ErrorCode, data.ErrorMessage)
+	}
+	return data, nil
+}
+
+// convert 将体彩的开奖结果转换为 KjggItem，号码无法拆分的期跳过
+func (s *sportteryDrawSource) convert(draws []sportteryDraw) []KjggItem {
+	var items []KjggItem
+	for _, d := range draws {
+		numbers := strings.Fields(d.LotteryDrawResult)
+		if len(numbers) != 7 {
+			fmt.Println("体彩第", d.LotteryDrawNum, "期开奖号码格式错误:", d.LotteryDrawResult)
+			continue
+		}
+		item := KjggItem{
+			Name:        "大乐透",
+			Code:        fullIssueCode(d.LotteryDrawNum),
+			Date:        d.LotteryDrawTime,
+			Red:         strings.Join(numbers[:5], ","),
+			Blue:        strings.Join(numbers[5:], ","),
+			Sales:       d.TotalSaleAmount,
+			PoolMoney:   d.PoolBalanceAfterdraw,
+			DetailsLink: d.DrawPdfUrl,
+		}
+		if day, err := time.ParseInLocation("2006-01-02", d.LotteryDrawTime, beijing); err == nil {
+			item.Week = chineseWeekdays[day.Weekday()]
+		}
+		for _, level := range d.PrizeLevelList {
+			if grade, ok := sportteryPrizeLevels[strings.TrimSpace(level.PrizeLevel)]; ok {
+				item.PrizeGrades = append(item.PrizeGrades, PrizeGradesItem{Type: grade, TypeNum: level.StakeCount, TypeMoney: level.StakeAmount})
+			}
+		}
+		items = append(items, item)
+	}
+	sortKjggItems(items)
+	return items
+}
+
+// fullIssueCode 五位期号补全为七位，如 24130 -> 2024130
+func fullIssueCode(code string) string {
+	code = strings.TrimSpace(code)
+	if len(code) == 5 {
+		return "20" + code
+	}
+	return code
+}
+
+// shortIssueCode 七位期号转换为体彩接口的五位期号，如 2024130 -> 24130
+func shortIssueCode(code string) string {
+	if len(code) == 7 {
+		return code[2:]
+	}
+	return code
+}
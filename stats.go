@@ -0,0 +1,269 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultStatsWindow 不带 window 参数时统计最近的期数
+const defaultStatsWindow = 100
+
+// 出现次数比期望高（低）20% 以上为热号（冷号）
+const (
+	hotRatio  = 1.2
+	coldRatio = 0.8
+)
+
+// Bucket 分布中的一项，如和值 105 出现 3 期、奇偶比 4:2 出现 10 期
+type Bucket struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// NumberStats 一个号码的统计
+type NumberStats struct {
+	Number      int     `json:"number"`
+	Count       int     `json:"count"`       // 统计期内出现的次数
+	Ratio       float64 `json:"ratio"`       // 出现次数和期望次数之比
+	Temperature string  `json:"temperature"` // hot、warm、cold
+	Omission    int     `json:"omission"`    // 当前遗漏，按全部历史计算
+	MaxOmission int     `json:"maxOmission"` // 最大遗漏，按全部历史计算
+}
+
+// GroupStats 一组号码（一个区，福彩3D 为三个位置的数字）的统计
+type GroupStats struct {
+	Name        string        `json:"name"`
+	Min         int           `json:"min"`
+	Max         int           `json:"max"`
+	Expected    float64       `json:"expected"` // 统计期内每个号码期望出现的次数
+	Numbers     []NumberStats `json:"numbers"`
+	OddEven     []Bucket      `json:"oddEven"`     // 奇数个数:偶数个数
+	BigSmall    []Bucket      `json:"bigSmall"`    // 大号个数:小号个数，大于中间值的为大号
+	Sum         []Bucket      `json:"sum"`         // 和值
+	Span        []Bucket      `json:"span"`        // 跨度，最大号码减最小号码
+	Consecutive []Bucket      `json:"consecutive"` // 相邻号码（如 05 06）的对数
+	Path012     []Bucket      `json:"path012"`     // 除以 3 余 0、1、2 的号码个数
+}
+
+// Stats 某个玩法最近 Window 期开奖号码的走势统计
+type Stats struct {
+	Game       string       `json:"game"`
+	Window     int          `json:"window"` // 实际统计的期数
+	FirstIssue string       `json:"firstIssue"`
+	LastIssue  string       `json:"lastIssue"`
+	Groups     []GroupStats `json:"groups"`
+}
+
+// digitGame 开奖号码按数字统计的玩法，如福彩3D 的百位、十位、个位合并为一组 0-9 的数字
+type digitGame interface {
+	digits(ticket Ticket) []int
+}
+
+// drawZoner 开奖号码比投注号码多出一些区的玩法，如七乐彩的特别号码，统计和走势图按开奖号码的区分组
+type drawZoner interface {
+	DrawZones() []Zone
+}
+
+// drawnZones 开奖号码的各区，默认为玩法默认投注方式的各区
+func drawnZones(game Game) []Zone {
+	if g, ok := game.(drawZoner); ok {
+		return g.DrawZones()
+	}
+	play, _ := gamePlay(game, "")
+	return game.ZonesFor(play)
+}
+
+// statsGroups 统计的号码分组及每期开奖号码在各组中的号码
+func statsGroups(game Game, draws []Ticket) ([]Zone, [][][]int) {
+	zones := drawnZones(game)
+	groups := make([][][]int, len(draws))
+	if g, ok := game.(digitGame); ok {
+		for k, draw := range draws {
+			groups[k] = [][]int{g.digits(draw)}
+		}
+		return []Zone{{Name: "号码", Min: 0, Max: 9, Pick: len(zones)}}, groups
+	}
+	for k, draw := range draws {
+		groups[k] = draw.Zones
+	}
+	return zones, groups
+}
+
+// computeStats 按期号升序的开奖号码及对应的期号计算最近 window 期（0 为全部）的统计，遗漏按全部历史计算
+func computeStats(game Game, history []Ticket, issues []DrawIssue, window int) Stats {
+	start := 0
+	if window > 0 && window < len(history) {
+		start = len(history) - window
+	}
+
+	stats := Stats{Game: game.Code(), Window: len(history) - start}
+	if len(issues) > 0 {
+		stats.FirstIssue, stats.LastIssue = issues[start].Code, issues[len(issues)-1].Code
+	}
+	zones, groups := statsGroups(game, history)
+	for i, zone := range zones {
+		var all [][]int
+		for _, numbers := range groups {
+			if i < len(numbers) {
+				all = append(all, numbers[i])
+			} else {
+				all = append(all, nil)
+			}
+		}
+		stats.Groups = append(stats.Groups, groupStats(zone, all, start))
+	}
+	return stats
+}
+
+// groupStats 一组号码的统计，all 为全部历史中该组的号码，从第 start 期开始统计分布
+func groupStats(zone Zone, all [][]int, start int) GroupStats {
+	result := GroupStats{Name: zone.Name, Min: zone.Min, Max: zone.Max}
+	recent := all[start:]
+
+	counts := make(map[int]int)
+	picked := 0
+	for _, numbers := range recent {
+		for _, n := range numbers {
+			counts[n]++
+		}
+		picked += len(numbers)
+	}
+	if len(recent) > 0 {
+		result.Expected = float64(picked) / float64(zone.Max-zone.Min+1)
+	}
+
+	for n := zone.Min; n <= zone.Max; n++ {
+		item := NumberStats{Number: n, Count: counts[n], Temperature: "warm"}
+		if result.Expected > 0 {
+			item.Ratio = float64(item.Count) / result.Expected
+			if item.Ratio >= hotRatio {
+				item.Temperature = "hot"
+			} else if item.Ratio <= coldRatio {
+				item.Temperature = "cold"
+			}
+		}
+		item.Omission, item.MaxOmission = omissions(all, n)
+		result.Numbers = append(result.Numbers, item)
+	}
+
+	oddEven, bigSmall, sum, span := newDistribution(), newDistribution(), newDistribution(), newDistribution()
+	consecutive, path012 := newDistribution(), newDistribution()
+	for _, numbers := range recent {
+		if len(numbers) == 0 {
+			continue
+		}
+		sorted := append([]int(nil), numbers...)
+		sort.Ints(sorted)
+
+		odd, big, total, pairs := 0, 0, 0, 0
+		paths := make([]int, 3)
+		for k, n := range sorted {
+			if n%2 == 1 {
+				odd++
+			}
+			if 2*n > zone.Min+zone.Max {
+				big++
+			}
+			total += n
+			paths[n%3]++
+			if k > 0 && sorted[k-1]+1 == n {
+				pairs++
+			}
+		}
+		oddEven.add(odd, len(sorted)-odd)
+		bigSmall.add(big, len(sorted)-big)
+		sum.add(total)
+		span.add(sorted[len(sorted)-1] - sorted[0])
+		consecutive.add(pairs)
+		path012.add(paths...)
+	}
+	result.OddEven, result.BigSmall = oddEven.buckets(), bigSmall.buckets()
+	result.Sum, result.Span = sum.buckets(), span.buckets()
+	result.Consecutive, result.Path012 = consecutive.buckets(), path012.buckets()
+	return result
+}
+
+// omissions 号码 n 的当前遗漏和最大遗漏（连续未开出的期数）
+func omissions(all [][]int, n int) (int, int) {
+	current, max := 0, 0
+	for _, numbers := range all {
+		hit := false
+		for _, m := range numbers {
+			if m == n {
+				hit = true
+				break
+			}
+		}
+		if hit {
+			current = 0
+			continue
+		}
+		current++
+		if current > max {
+			max = current
+		}
+	}
+	return current, max
+}
+
+// distribution 统计每期的某个指标（一个或多个整数，如奇偶比 4:2）出现的期数
+type distribution struct {
+	counts map[string]int
+	keys   map[string][]int
+}
+
+func newDistribution() *distribution {
+	return &distribution{counts: make(map[string]int), keys: make(map[string][]int)}
+}
+
+func (d *distribution) add(key ...int) {
+	parts := make([]string, len(key))
+	for i, k := range key {
+		parts[i] = strconv.Itoa(k)
+	}
+	value := strings.Join(parts, ":")
+	d.counts[value]++
+	d.keys[value] = key
+}
+
+// buckets 按指标从小到大排列
+func (d *distribution) buckets() []Bucket {
+	result := make([]Bucket, 0, len(d.counts))
+	for value, count := range d.counts {
+		result = append(result, Bucket{Value: value, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := d.keys[result[i].Value], d.keys[result[j].Value]
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+	return result
+}
+
+// statsFunc 返回某个玩法最近 window 期的走势统计：各号码出现次数、冷热、遗漏，奇偶比、大小比、和值、跨度、连号、012路分布
+//
+//	GET /api/stats?game=ssq&window=100
+func (s *server) statsFunc(w http.ResponseWriter, r *http.Request) {
+	game, err := requestGame(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	window := defaultStatsWindow
+	if value := r.Form.Get("window"); value != "" {
+		if window, err = strconv.Atoi(value); err != nil || window < 0 {
+			http.Error(w, "window参数应为非负整数，0表示全部", http.StatusBadRequest)
+			return
+		}
+	}
+
+	//直接用模型缓存的开奖号码，不再每次查库解析全部开奖结果
+	history, issues := s.models.Draws(game)
+	writeJSON(w, computeStats(game, history, issues, window))
+}
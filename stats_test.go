@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+// getJSON 调用 handler 并把返回的 JSON 解析到 v
+func getJSON(t *testing.T, handler func(w *httptest.ResponseRecorder), v interface{}) {
+	w := httptest.NewRecorder()
+	handler(w)
+	if w.Code != 200 {
+		t.Fatalf("请求失败: %d %s", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatsUsesModelCache(t *testing.T) {
+	game, _ := gameByCode("ssq")
+	store := newTestStore(t)
+	items := ssqFixtureItems()
+	if _, err := saveKjggItems(store, game, items[:20]); err != nil {
+		t.Fatal(err)
+	}
+	s := &server{store: store, models: newModelCache()}
+	if err := s.models.Load(store, game); err != nil {
+		t.Fatal(err)
+	}
+	stats := func(query string) Stats {
+		var result Stats
+		getJSON(t, func(w *httptest.ResponseRecorder) {
+			r := httptest.NewRequest("GET", "/api/stats?"+query, nil)
+			r.ParseForm()
+			s.statsFunc(w, r)
+		}, &result)
+		return result
+	}
+
+	result := stats("game=ssq&window=5")
+	if result.Window != 5 || result.FirstIssue != "2022002" || result.LastIssue != "2022006" {
+		t.Errorf("最近 5 期应为 2022002-2022006，实际 %d 期 %s-%s", result.Window, result.FirstIssue, result.LastIssue)
+	}
+	if result = stats("game=ssq&window=0"); result.Window != 20 || result.FirstIssue != "2021140" {
+		t.Errorf("window=0 应统计全部 20 期，实际 %d 期从 %s 开始", result.Window, result.FirstIssue)
+	}
+
+	//新入库的开奖结果在模型更新后才出现在统计中
+	if _, err := saveKjggItems(store, game, items[20:]); err != nil {
+		t.Fatal(err)
+	}
+	if result = stats("game=ssq&window=5"); result.LastIssue != "2022006" {
+		t.Errorf("模型更新前应仍统计到 2022006，实际 %s", result.LastIssue)
+	}
+	if _, err := s.models.Refresh(store, game); err != nil {
+		t.Fatal(err)
+	}
+	if result = stats("game=ssq&window=5"); result.LastIssue != "2022010" || result.Window != 5 {
+		t.Errorf("模型更新后应统计到 2022010，实际 %d 期到 %s", result.Window, result.LastIssue)
+	}
+}
+
+func TestStatsQlcSpecialNumber(t *testing.T) {
+	game, _ := gameByCode("qlc")
+	store := newTestStore(t)
+	items := []KjggItem{
+		{Code: "2022001", Date: "2022-01-03(一)", Red: "01,02,03,04,05,06,07", Blue: "30"},
+		{Code: "2022002", Date: "2022-01-05(三)", Red: "08,09,10,11,12,13,14", Blue: "01"},
+		{Code: "2022003", Date: "2022-01-07(五)", Red: "01,09,15,16,17,18,19", Blue: "30"},
+	}
+	if _, err := saveKjggItems(store, game, items); err != nil {
+		t.Fatal(err)
+	}
+	s := &server{store: store, models: newModelCache()}
+	if err := s.models.Load(store, game); err != nil {
+		t.Fatal(err)
+	}
+	history, issues := s.models.Draws(game)
+	stats := computeStats(game, history, issues, 0)
+	chart := computeTrend(game, history, issues, 30)
+
+	if len(stats.Groups) != len(chart.Groups) {
+		t.Fatalf("统计有 %d 组，走势图有 %d 组", len(stats.Groups), len(chart.Groups))
+	}
+	for i := range stats.Groups {
+		if stats.Groups[i].Name != chart.Groups[i].Name {
+			t.Errorf("第 %d 组统计为 %s，走势图为 %s", i, stats.Groups[i].Name, chart.Groups[i].Name)
+		}
+	}
+	special := stats.Groups[1]
+	if special.Name != "特别号码" || special.Numbers[29].Count != 2 || special.Numbers[0].Count != 1 || special.Numbers[0].Omission != 1 {
+		t.Errorf("特别号码统计不对: %+v", special.Numbers[:1])
+	}
+	if basic := stats.Groups[0]; basic.Numbers[0].Count != 2 || basic.Numbers[29].Count != 0 {
+		t.Errorf("基本号码统计不应包含特别号码: 01 出现 %d 次，30 出现 %d 次", basic.Numbers[0].Count, basic.Numbers[29].Count)
+	}
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// LotteryStore 封装对 sqlite 数据库的全部访问
+// 进程内只创建一个，所有 handler 和定时任务共用同一个连接池
+type LotteryStore struct {
+	db   *sql.DB
+	path string
+}
+
+// OpenLotteryStore 打开（不存在则创建）指定路径的数据库，相对路径以工作目录为准
+// 数据库以 WAL 模式打开，读请求不会被定时任务的写入阻塞
+func OpenLotteryStore(path string) (*LotteryStore, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("解析数据库路径 %s 失败: %w", path, err)
+	}
+
+	dsn := "file:" + absPath + "?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on"
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("打开数据库 %s 失败: %w", absPath, err)
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("连接数据库 %s 失败: %w", absPath, err)
+	}
+
+	return &LotteryStore{db: db, path: absPath}, nil
+}
+
+// Path 返回数据库文件的绝对路径
+func (s *LotteryStore) Path() string {
+	return s.path
+}
+
+// Close 关闭连接池
+func (s *LotteryStore) Close() error {
+	return s.db.Close()
+}
+
+// InsertLottery 保存一注生成的号码及其参与的期号，返回新记录的 id
+// 页面显示 record.Numbers，计奖使用按胆码、拖码、其余各区分开保存的号码
+func (s *LotteryStore) InsertLottery(game string, issueCode string, record TicketRecord) (int64, error) {
+	return insertTicket(s.db, game, issueCode, record)
+}
+
+// TicketRecord 待保存的一注号码
+type TicketRecord struct {
+	Ticket     Ticket
+	Numbers    string // 页面显示的号码
+	Bets       int
+	Strategy   string     // 生成方式
+	Params     string     // 生成方式的参数，如 window=30
+	Provenance Provenance // 复现号码所需的种子等信息
+}
+
+// InsertLotterys 在同一个事务中保存多注号码，任何一注失败时全部不保存，返回各注的 id
+func (s *LotteryStore) InsertLotterys(game string, issueCode string, records []TicketRecord) ([]int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	ids := make([]int64, len(records))
+	for i, record := range records {
+		if ids[i], err = insertTicket(tx, game, issueCode, record); err != nil {
+			return nil, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交号码失败: %w", err)
+	}
+	return ids, nil
+}
+
+// execer 是 *sql.DB 和 *sql.Tx 共有的 Exec
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertTicket(db execer, game string, issueCode string, record TicketRecord) (int64, error) {
+	bankers, drags, blues := ticketColumns(record.Ticket)
+	p := record.Provenance
+	//只有 hmac 模式有 nonce
+	var nonce sql.NullInt64
+	if p.Entropy == "hmac" {
+		nonce = sql.NullInt64{Int64: p.Nonce, Valid: true}
+	}
+	res, err := db.Exec(`insert into tickets (game, play, numbers, bankers, drags, blues, bets, strategy, params, issue_code,
+		seed, entropy, client_seed, nonce, commitment, model_issue, request)
+		values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		game, record.Ticket.Play, record.Numbers, bankers, drags, blues, record.Bets, record.Strategy, record.Params, issueCode,
+		p.Seed, p.Entropy, p.ClientSeed, nonce, p.Commitment, p.ModelIssue, p.Request)
+	if err != nil {
+		return 0, fmt.Errorf("保存号码失败: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("获取新增id失败: %w", err)
+	}
+	return id, nil
+}
+
+// TicketNumbers 返回某个玩法已生成过的全部号码，用于批量生成时去重
+func (s *LotteryStore) TicketNumbers(game string) (map[string]bool, error) {
+	rows, err := s.db.Query("select numbers from tickets where game=? and numbers is not null;", game)
+	if err != nil {
+		return nil, fmt.Errorf("查询已生成号码失败: %w", err)
+	}
+	defer rows.Close()
+
+	numbers := make(map[string]bool)
+	for rows.Next() {
+		var item string
+		if err = rows.Scan(&item); err != nil {
+			return nil, fmt.Errorf("读取已生成号码失败: %w", err)
+		}
+		numbers[item] = true
+	}
+	return numbers, rows.Err()
+}
+
+const lotteryQuery = `select t.id, t.game, t.play, t.numbers, t.bets, t.strategy, t.params, t.create_time, coalesce(d.code, t.issue_code), d.draw_date, d.week, d.red, d.blue,
+		r.prize_grade, r.prize_money,
+		(select group_concat(g.prize_grade || ':' || g.bet_count) from ticket_result_tiers g where g.ticket_id = t.id)
+	from tickets t
+	left join ticket_results r on r.ticket_id = t.id
+	left join draws d on d.game = t.game and d.code = r.draw_code
+	where t.game = ?
+	order by t.create_time desc, t.id desc`
+
+// ListLotterys 按生成时间倒序返回某个玩法的全部号码记录
+func (s *LotteryStore) ListLotterys(game string) ([]Lotterys, error) {
+	return s.queryLotterys(lotteryQuery+";", game)
+}
+
+// ListLotterysWithPage 按生成时间倒序分页返回某个玩法的号码记录，page 从 1 开始
+func (s *LotteryStore) ListLotterysWithPage(game string, page int, pagecount int) ([]Lotterys, error) {
+	if page > 0 {
+		page = page - 1
+	}
+	offset := page * pagecount
+	return s.queryLotterys(lotteryQuery+" LIMIT ? OFFSET ?;", game, pagecount, offset)
+}
+
+func (s *LotteryStore) queryLotterys(querySql string, args ...interface{}) ([]Lotterys, error) {
+	rows, err := s.db.Query(querySql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询号码记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	var results []Lotterys
+	for rows.Next() {
+		var item Lotterys
+		var week, tiers sql.NullString
+		var prizeMoney sql.NullInt64
+		err = rows.Scan(&item.Id, &item.Game, &item.Play, &item.Lottery, &item.Bets, &item.Strategy, &item.Params, &item.CreateTime, &item.Code, &item.Date, &week, &item.Red, &item.Blue,
+			&item.MyPrizeGrade, &prizeMoney, &tiers)
+		if err != nil {
+			return nil, fmt.Errorf("读取号码记录失败: %w", err)
+		}
+
+		//各奖级中奖注数：1:2,3:5
+		item.Cost = fenToYuan(int64(item.Bets) * ticketPrice)
+		item.Tiers = make(map[int]int)
+		for _, pair := range strings.Split(tiers.String, ",") {
+			var grade, count int
+			if _, err := fmt.Sscanf(pair, "%d:%d", &grade, &count); err == nil {
+				item.Tiers[grade] = count
+			}
+		}
+
+		//页面上展示的开奖日期沿用公告里的 2022-02-08(二) 格式
+		item.Week = week.String
+		item.PrizeMoney = fenToYuan(prizeMoney.Int64)
+		if item.Date.Valid && item.Week != "" {
+			item.Date.String += "(" + item.Week + ")"
+		}
+		if item.Red.Valid {
+			item.Red.String = strings.Replace(item.Red.String, ",", " ", -1)
+		}
+		if item.Blue.Valid {
+			item.Blue.String = strings.Replace(item.Blue.String, ",", " ", -1)
+		}
+		if item.CreateTime.Valid {
+			item.CreateTimeStr = item.CreateTime.Time.Format("2006-01-02 15:04:05")
+		}
+		results = append(results, item)
+	}
+	return results, rows.Err()
+}
+
+// PendingTicket 是尚未计算奖级的号码，以及它应参与的那一期
+type PendingTicket struct {
+	TicketId int
+	Game     string
+	Play     string
+	Numbers  string
+	Bankers  string
+	Drags    string
+	Blues    string
+	DrawCode string
+}
+
+// Ticket 由分开保存的各区号码还原
+func (p PendingTicket) Ticket() (Ticket, error) {
+	return ticketFromColumns(p.Play, p.Bankers, p.Drags, p.Blues)
+}
+
+// ticketColumns 号码按 tickets 表的 bankers、drags、blues 三列保存：
+// bankers 为胆码，drags 为第一个区的其余号码（非胆拖号码即第一个区全部号码），
+// blues 为其余各区，区之间以 + 分隔；区内号码都以逗号分隔，和 draws 表一致
+func ticketColumns(ticket Ticket) (bankers string, drags string, blues string) {
+	if len(ticket.Zones) == 0 {
+		return "", "", ""
+	}
+	var parts []string
+	for _, zone := range ticket.Zones[1:] {
+		parts = append(parts, formatNumbers(zone, ","))
+	}
+	return formatNumbers(ticket.Bankers, ","), formatNumbers(ticket.Zones[0], ","), strings.Join(parts, "+")
+}
+
+// ticketFromColumns 是 ticketColumns 的逆过程
+func ticketFromColumns(play string, bankers string, drags string, blues string) (Ticket, error) {
+	ticket := Ticket{Play: play}
+	var err error
+	if ticket.Bankers, err = parseNumbers(bankers, ","); err != nil {
+		return ticket, err
+	}
+	first, err := parseNumbers(drags, ",")
+	if err != nil {
+		return ticket, err
+	}
+	if len(first) == 0 {
+		return ticket, fmt.Errorf("号码缺少第一个区")
+	}
+	ticket.Zones = append(ticket.Zones, first)
+	if blues == "" {
+		return ticket, nil
+	}
+	for _, part := range strings.Split(blues, "+") {
+		zone, err := parseNumbers(part, ",")
+		if err != nil {
+			return ticket, err
+		}
+		ticket.Zones = append(ticket.Zones, zone)
+	}
+	return ticket, nil
+}
+
+// PendingTickets 查询已经开奖但还没有计算奖级的号码
+// 号码按生成时记录的期号关联开奖结果，升级前生成、没有期号的号码按开奖日 20:00 停售归到对应的一期
+func (s *LotteryStore) PendingTickets() ([]PendingTicket, error) {
+	querySql := `select t.id, t.game, t.play, t.numbers, t.bankers, t.drags, t.blues, d.code
+		from tickets t
+		join draws d on d.game = t.game and d.code = coalesce(t.issue_code, (select d2.code from draws d2
+			where d2.game = t.game and d2.draw_date || ' 20:00:00' > t.create_time order by d2.draw_date limit 1))
+		where not exists (select 1 from ticket_results r where r.ticket_id = t.id)
+		order by t.create_time;`
+	rows, err := s.db.Query(querySql)
+	if err != nil {
+		return nil, fmt.Errorf("查询待开奖号码失败: %w", err)
+	}
+	defer rows.Close()
+
+	var results []PendingTicket
+	for rows.Next() {
+		var item PendingTicket
+		if err = rows.Scan(&item.TicketId, &item.Game, &item.Play, &item.Numbers, &item.Bankers, &item.Drags, &item.Blues, &item.DrawCode); err != nil {
+			return nil, fmt.Errorf("读取待开奖号码失败: %w", err)
+		}
+		results = append(results, item)
+	}
+	return results, rows.Err()
+}
+
+// GradedTickets 查询已经计过奖的号码，用于按规则重新计奖
+func (s *LotteryStore) GradedTickets() ([]PendingTicket, error) {
+	rows, err := s.db.Query(`select t.id, t.game, t.play, t.numbers, t.bankers, t.drags, t.blues, r.draw_code from tickets t
+		join ticket_results r on r.ticket_id = t.id order by t.create_time;`)
+	if err != nil {
+		return nil, fmt.Errorf("查询已开奖号码失败: %w", err)
+	}
+	defer rows.Close()
+
+	var results []PendingTicket
+	for rows.Next() {
+		var item PendingTicket
+		if err = rows.Scan(&item.TicketId, &item.Game, &item.Play, &item.Numbers, &item.Bankers, &item.Drags, &item.Blues, &item.DrawCode); err != nil {
+			return nil, fmt.Errorf("读取已开奖号码失败: %w", err)
+		}
+		results = append(results, item)
+	}
+	return results, rows.Err()
+}
+
+// TicketResult 是一注号码在某一期的中奖情况
+// 复式号码的 PrizeGrade 为展开后最高的奖级，PrizeMoney 为全部单式的奖金之和
+type TicketResult struct {
+	TicketId   int
+	DrawCode   string
+	RedCount   int
+	BlueCount  int
+	PrizeGrade int
+	PrizeMoney int64  // 分
+	RuleSet    string // 计奖时使用的规则
+	Tiers      []TierResult
+}
+
+// TierResult 号码展开后在某个奖级中奖的注数和奖金
+type TierResult struct {
+	PrizeGrade int
+	BetCount   int
+	PrizeMoney int64 // 分，该奖级全部注数的奖金之和
+}
+
+// SaveTicketResult 记录号码的中奖情况，重复计算时覆盖旧结果
+func (s *LotteryStore) SaveTicketResult(result TicketResult) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`insert or replace into ticket_results (ticket_id, draw_code, red_count, blue_count, prize_grade, prize_money, rule_set)
+		values (?, ?, ?, ?, ?, ?, ?);`, result.TicketId, result.DrawCode, result.RedCount, result.BlueCount, result.PrizeGrade,
+		result.PrizeMoney, result.RuleSet)
+	if err != nil {
+		return fmt.Errorf("更新ID:%d 失败: %w", result.TicketId, err)
+	}
+	if _, err = tx.Exec("delete from ticket_result_tiers where ticket_id=?;", result.TicketId); err != nil {
+		return fmt.Errorf("清理ID:%d 的奖级明细失败: %w", result.TicketId, err)
+	}
+	for _, tier := range result.Tiers {
+		_, err = tx.Exec("insert into ticket_result_tiers (ticket_id, prize_grade, bet_count, prize_money) values (?, ?, ?, ?);",
+			result.TicketId, tier.PrizeGrade, tier.BetCount, tier.PrizeMoney)
+		if err != nil {
+			return fmt.Errorf("保存ID:%d 的奖级明细失败: %w", result.TicketId, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadDatas 汇总某个玩法的号码总数、各奖级的中奖注数以及投入和奖金
+// 复式号码按展开后的单式注数计算投入，各奖级的数量也是注数
+func (s *LotteryStore) LoadDatas(game string) ([]LotteryDatas, error) {
+	item := LotteryDatas{GradeCounts: make(map[int]int), PlayGradeCounts: make(map[string]map[int]int)}
+	var totalBets int64
+	err := s.db.QueryRow("select count(1), coalesce(sum(bets), 0) from tickets where game=?;", game).Scan(&item.TotalCount, &totalBets)
+	if err != nil {
+		return nil, fmt.Errorf("汇总号码数量失败: %w", err)
+	}
+
+	var gradedBets, totalPrize int64
+	err = s.db.QueryRow(`select coalesce(sum(t.bets), 0), coalesce(sum(r.prize_money), 0)
+		from ticket_results r join tickets t on t.id = r.ticket_id where t.game = ?;`, game).Scan(&gradedBets, &totalPrize)
+	if err != nil {
+		return nil, fmt.Errorf("汇总中奖金额失败: %w", err)
+	}
+
+	rows, err := s.db.Query(`select t.play, g.prize_grade, sum(g.bet_count)
+		from ticket_result_tiers g join tickets t on t.id = g.ticket_id
+		where t.game = ? group by t.play, g.prize_grade;`, game)
+	if err != nil {
+		return nil, fmt.Errorf("汇总中奖数据失败: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var play string
+		var grade, count int
+		if err = rows.Scan(&play, &grade, &count); err != nil {
+			return nil, fmt.Errorf("读取中奖数据失败: %w", err)
+		}
+		item.GradeCounts[grade] += count
+		//有多种投注方式的玩法，各投注方式的奖级含义不同，再按投注方式分开统计
+		if play != "" {
+			if item.PlayGradeCounts[play] == nil {
+				item.PlayGradeCounts[play] = make(map[int]int)
+			}
+			item.PlayGradeCounts[play][grade] = count
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取中奖数据失败: %w", err)
+	}
+
+	//旧页面按奖级读取的字段，其中 7 在双色球是福运奖
+	item.FirstCount, item.SecondCount, item.ThirdCount = item.GradeCounts[1], item.GradeCounts[2], item.GradeCounts[3]
+	item.ForthCount, item.FifthCount, item.SixthCount = item.GradeCounts[4], item.GradeCounts[5], item.GradeCounts[6]
+	item.LuckyCount = item.GradeCounts[7]
+
+	//投入按全部号码计算，回报率只看已开奖的号码
+	item.TotalCost = fenToYuan(totalBets * ticketPrice)
+	item.TotalPrize = fenToYuan(totalPrize)
+	if gradedBets > 0 {
+		gradedCost := gradedBets * ticketPrice
+		item.ROI = float64(totalPrize-gradedCost) / float64(gradedCost)
+	}
+	return []LotteryDatas{item}, nil
+}
+
+// ReadHistoryData 读取某个玩法的历史开奖号码，按期号从早到晚排列
+func (s *LotteryStore) ReadHistoryData(game Game) ([]Ticket, error) {
+	draws, err := s.ListDraws(game.Code())
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]Ticket, 0, len(draws))
+	for _, draw := range draws {
+		numbers, err := game.DrawNumbers(draw)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, numbers)
+	}
+	return history, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// trendIssues 走势图可选的期数
+var trendIssues = []int{30, 50, 100}
+
+// TrendGroup 走势图的一组号码，双色球为红球、蓝球，福彩3D 为百位、十位、个位，七乐彩为基本号码、特别号码
+type TrendGroup struct {
+	Name string `json:"name"`
+	Min  int    `json:"min"`
+	Max  int    `json:"max"`
+	Line bool   `json:"line"` // 每期只开出一个号码，页面上把各期的号码连线
+}
+
+// TrendRow 走势图的一行，即一期
+type TrendRow struct {
+	Issue    string  `json:"issue"`
+	DrawDate string  `json:"drawDate"`
+	Numbers  [][]int `json:"numbers"` // 各组开出的号码
+	Cells    [][]int `json:"cells"`   // 各组从 Min 到 Max 每个号码的值：0 为本期开出，否则为截至本期的遗漏期数
+}
+
+// TrendSummary 走势图底部各组每个号码的统计，只统计图中的期
+type TrendSummary struct {
+	Counts      []int     `json:"counts"`      // 出现次数
+	AvgOmission []float64 `json:"avgOmission"` // 平均遗漏，未开出的期数/(出现次数+1)
+	MaxOmission []int     `json:"maxOmission"` // 最大遗漏
+	MaxStreak   []int     `json:"maxStreak"`   // 最大连出
+}
+
+// TrendChart 走势图的全部数据
+type TrendChart struct {
+	Game    string         `json:"game"`
+	Issues  int            `json:"issues"`
+	Groups  []TrendGroup   `json:"groups"`
+	Rows    []TrendRow     `json:"rows"`
+	Summary []TrendSummary `json:"summary"`
+}
+
+// computeTrend 一次遍历按期号升序的全部开奖号码及对应的期号，得到最近 issues 期的走势图；
+// 遗漏从第一期开始累计，图中第一行的遗漏也包含图外的期数
+func computeTrend(game Game, history []Ticket, drawIssues []DrawIssue, issues int) TrendChart {
+	zones := drawnZones(game)
+	chart := TrendChart{Game: game.Code()}
+	omissions := make([][]int, len(zones))
+	for i, zone := range zones {
+		chart.Groups = append(chart.Groups, TrendGroup{Name: zone.Name, Min: zone.Min, Max: zone.Max, Line: zone.Pick == 1})
+		omissions[i] = make([]int, zone.Max-zone.Min+1)
+	}
+
+	start := 0
+	if len(history) > issues {
+		start = len(history) - issues
+	}
+
+	//图外的期只累计遗漏，不保存行
+	for k, numbers := range history {
+		inChart := k >= start
+		row := TrendRow{Issue: drawIssues[k].Code, DrawDate: drawIssues[k].DrawDate}
+		for i, zone := range zones {
+			var drawn []int
+			if i < len(numbers.Zones) {
+				drawn = numbers.Zones[i]
+			}
+			hits := make(map[int]bool)
+			for _, n := range drawn {
+				hits[n] = true
+			}
+			for n := zone.Min; n <= zone.Max; n++ {
+				if hits[n] {
+					omissions[i][n-zone.Min] = 0
+				} else {
+					omissions[i][n-zone.Min]++
+				}
+			}
+			if inChart {
+				row.Numbers = append(row.Numbers, drawn)
+				row.Cells = append(row.Cells, append([]int(nil), omissions[i]...))
+			}
+		}
+		if inChart {
+			chart.Rows = append(chart.Rows, row)
+		}
+	}
+	chart.Issues = len(chart.Rows)
+
+	for i, zone := range zones {
+		chart.Summary = append(chart.Summary, trendSummary(chart.Rows, i, zone.Max-zone.Min+1))
+	}
+	return chart
+}
+
+// trendSummary 第 i 组 size 个号码在图中各期的出现次数、平均遗漏、最大遗漏和最大连出
+func trendSummary(rows []TrendRow, i int, size int) TrendSummary {
+	summary := TrendSummary{
+		Counts:      make([]int, size),
+		AvgOmission: make([]float64, size),
+		MaxOmission: make([]int, size),
+		MaxStreak:   make([]int, size),
+	}
+	for n := 0; n < size; n++ {
+		missed, streak := 0, 0
+		for _, row := range rows {
+			if row.Cells[i][n] == 0 {
+				summary.Counts[n]++
+				streak++
+				if streak > summary.MaxStreak[n] {
+					summary.MaxStreak[n] = streak
+				}
+			} else {
+				missed++
+				streak = 0
+				if row.Cells[i][n] > summary.MaxOmission[n] {
+					summary.MaxOmission[n] = row.Cells[i][n]
+				}
+			}
+		}
+		summary.AvgOmission[n] = float64(missed) / float64(summary.Counts[n]+1)
+	}
+	return summary
+}
+
+// trendFunc 返回最近 issues 期（30、50、100，默认 30）的走势图数据
+//
+//	GET /api/trend?game=ssq&issues=50
+func (s *server) trendFunc(w http.ResponseWriter, r *http.Request) {
+	game, err := requestGame(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	issues := trendIssues[0]
+	if value := r.Form.Get("issues"); value != "" {
+		issues, err = strconv.Atoi(value)
+		valid := false
+		for _, n := range trendIssues {
+			valid = valid || n == issues
+		}
+		if err != nil || !valid {
+			http.Error(w, fmt.Sprintf("issues参数应为%v之一", trendIssues), http.StatusBadRequest)
+			return
+		}
+	}
+
+	history, drawIssues := s.models.Draws(game)
+	writeJSON(w, computeTrend(game, history, drawIssues, issues))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrendQlcSpecialNumber(t *testing.T) {
+	game, _ := gameByCode("qlc")
+	store := newTestStore(t)
+	items := []KjggItem{
+		{Code: "2022001", Date: "2022-01-03(一)", Red: "01,02,03,04,05,06,07", Blue: "30"},
+		{Code: "2022002", Date: "2022-01-05(三)", Red: "08,09,10,11,12,13,14", Blue: "01"},
+		{Code: "2022003", Date: "2022-01-07(五)", Red: "01,09,15,16,17,18,19", Blue: "30"},
+	}
+	if _, err := saveKjggItems(store, game, items); err != nil {
+		t.Fatal(err)
+	}
+	s := &server{store: store, models: newModelCache()}
+	if err := s.models.Load(store, game); err != nil {
+		t.Fatal(err)
+	}
+
+	var chart TrendChart
+	getJSON(t, func(w *httptest.ResponseRecorder) {
+		r := httptest.NewRequest("GET", "/api/trend?game=qlc", nil)
+		r.ParseForm()
+		s.trendFunc(w, r)
+	}, &chart)
+
+	if len(chart.Groups) != 2 || chart.Groups[1].Name != "特别号码" || !chart.Groups[1].Line || chart.Groups[0].Line {
+		t.Fatalf("七乐彩应有基本号码和连线的特别号码两组: %+v", chart.Groups)
+	}
+	if chart.Issues != 3 || chart.Rows[2].Issue != "2022003" || chart.Rows[2].DrawDate != "2022-01-07" {
+		t.Fatalf("走势图的期不对: %+v", chart.Rows)
+	}
+	last := chart.Rows[2]
+	if len(last.Numbers) != 2 || len(last.Numbers[1]) != 1 || last.Numbers[1][0] != 30 {
+		t.Errorf("2022003 期特别号码应为 30: %+v", last.Numbers)
+	}
+	//特别号码 30 本期开出，01 上期开出后遗漏 1 期；基本号码 01 本期开出
+	if last.Cells[1][29] != 0 || last.Cells[1][0] != 1 || last.Cells[0][0] != 0 || last.Cells[0][7] != 1 {
+		t.Errorf("2022003 期遗漏不对: %+v", last.Cells)
+	}
+	if chart.Summary[1].Counts[29] != 2 || chart.Summary[1].Counts[0] != 1 {
+		t.Errorf("特别号码出现次数不对: %+v", chart.Summary[1].Counts)
+	}
+}